@@ -0,0 +1,33 @@
+package main
+
+import "fmt"
+
+var ErrArgMissing = fmt.Errorf("argument missing")
+var ErrArgType = fmt.Errorf("argument has wrong type")
+
+// Arg returns the argument at the index converted to T. It's the safe
+// alternative to args[i].(T) for guards and callbacks.
+func Arg[T any](args []any, i int) (T, error) {
+	var zero T
+
+	if i < 0 || i >= len(args) {
+		return zero, fmt.Errorf("argument %d: %w", i, ErrArgMissing)
+	}
+
+	value, ok := args[i].(T)
+	if !ok {
+		return zero, fmt.Errorf("argument %d: %w: expected %T, got %T", i, ErrArgType, zero, args[i])
+	}
+
+	return value, nil
+}
+
+// ArgInt returns the int argument at the index
+func ArgInt(args []any, i int) (int, error) {
+	return Arg[int](args, i)
+}
+
+// ArgString returns the string argument at the index
+func ArgString(args []any, i int) (string, error) {
+	return Arg[string](args, i)
+}
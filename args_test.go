@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArgs(t *testing.T) {
+	args := []any{100, "xfr"}
+
+	amount, err := ArgInt(args, 0)
+	require.NoError(t, err)
+	require.Equal(t, 100, amount)
+
+	id, err := ArgString(args, 1)
+	require.NoError(t, err)
+	require.Equal(t, "xfr", id)
+
+	_, err = ArgInt(args, 2)
+	require.ErrorIs(t, err, ErrArgMissing)
+	require.EqualError(t, err, "argument 2: argument missing")
+
+	_, err = ArgInt(args, -1)
+	require.ErrorIs(t, err, ErrArgMissing)
+
+	_, err = ArgInt(args, 1)
+	require.ErrorIs(t, err, ErrArgType)
+	require.EqualError(t, err, "argument 1: argument has wrong type: expected int, got string")
+
+	_, err = ArgString(args, 0)
+	require.ErrorIs(t, err, ErrArgType)
+}
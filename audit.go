@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// AuditTrail is a serializable record of a fire kept for compliance.
+// Args are redacted by the redactor configured in Options.
+type AuditTrail struct {
+	Event  string            `json:"event"`
+	From   State             `json:"from"`
+	Guards []GuardAuditEntry `json:"guards"`
+
+	// Selected is the transition that was executed, nil if none
+	Selected *TransitionAuditEntry `json:"selected,omitempty"`
+
+	// OnError is the error returned by On, if any
+	OnError string `json:"on_error,omitempty"`
+
+	// State is the state of the subject after the fire
+	State State  `json:"state"`
+	Error string `json:"error,omitempty"`
+}
+
+// GuardAuditEntry records the evaluation of the guard of a transition
+type GuardAuditEntry struct {
+	From    State    `json:"from"`
+	To      State    `json:"to"`
+	Args    []string `json:"args"`
+	Allowed bool     `json:"allowed"`
+}
+
+type TransitionAuditEntry struct {
+	From State `json:"from"`
+	To   State `json:"to"`
+}
+
+// redactArg is the default redactor. It keeps only the type of the arg.
+func redactArg(arg any) string {
+	return fmt.Sprintf("%T", arg)
+}
+
+// FireAudited fires the event like Fire and returns the audit trail of
+// the fire. All guards of the transitions from the current state are
+// evaluated and recorded, even after the first allowed one is found.
+func (sm *StateMachine) FireAudited(name string, args ...any) (AuditTrail, error) {
+	sm.lockFire()
+	defer sm.unlockFire()
+
+	trace := &fireTrace{audit: true}
+	err := sm.fireTraced(context.Background(), trace, name, args...)
+	err = sm.handleError(name, err)
+
+	redact := sm.auditRedact
+	if redact == nil {
+		redact = redactArg
+	}
+
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		redacted[i] = redact(arg)
+	}
+
+	trail := AuditTrail{
+		Event:  name,
+		From:   trace.from,
+		Guards: make([]GuardAuditEntry, 0, len(trace.guards)),
+		State:  sm.currentState,
+	}
+
+	for _, evaluation := range trace.guards {
+		trail.Guards = append(trail.Guards, GuardAuditEntry{
+			From:    evaluation.transition.From,
+			To:      evaluation.transition.To,
+			Args:    redacted,
+			Allowed: evaluation.allowed,
+		})
+	}
+
+	if trace.transition != nil {
+		trail.Selected = &TransitionAuditEntry{
+			From: trace.transition.From,
+			To:   trace.transition.To,
+		}
+	}
+
+	if trace.onErr != nil {
+		trail.OnError = trace.onErr.Error()
+	}
+
+	if err != nil {
+		trail.Error = err.Error()
+	}
+
+	return trail, err
+}
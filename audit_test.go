@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFireAudited(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(transferEvents(xfr))
+
+	err := sm.Fire("authorize", 100)
+	require.NoError(t, err)
+
+	trail, err := sm.FireAudited("void", 50)
+	require.NoError(t, err)
+
+	require.Equal(t, AuditTrail{
+		Event: "void",
+		From:  StateAuthorized,
+		Guards: []GuardAuditEntry{
+			{From: StateAuthorized, To: StatePartiallyAuthorized, Args: []string{"int"}, Allowed: true},
+			{From: StateAuthorized, To: StateVoided, Args: []string{"int"}, Allowed: false},
+		},
+		Selected: &TransitionAuditEntry{From: StateAuthorized, To: StatePartiallyAuthorized},
+		State:    StatePartiallyAuthorized,
+	}, trail)
+
+	_, err = json.Marshal(trail)
+	require.NoError(t, err)
+}
+
+func TestFireAuditedRejected(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		AuditRedact: func(arg any) string {
+			return "***"
+		},
+	})
+	sm.SetEvents(transferEvents(xfr))
+
+	err := sm.Fire("authorize", 100)
+	require.NoError(t, err)
+
+	trail, err := sm.FireAudited("void", 150)
+	require.ErrorIs(t, err, ErrNoTransitionForEvent)
+
+	require.Nil(t, trail.Selected)
+	require.Equal(t, StateAuthorized, trail.State)
+	require.Equal(t, "event void: no transition for event", trail.Error)
+	require.Equal(t, []GuardAuditEntry{
+		{From: StateAuthorized, To: StatePartiallyAuthorized, Args: []string{"***"}, Allowed: false},
+		{From: StateAuthorized, To: StateVoided, Args: []string{"***"}, Allowed: false},
+	}, trail.Guards)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Timeout fires the event when the machine stays in the state for
+// longer than After
+type Timeout struct {
+	After time.Duration
+	Event string
+}
+
+// automatic keeps track of the timer-driven and auto-fire transitions
+type automatic struct {
+	paused bool
+
+	// started is set once the automatic events of the current state
+	// were fired, see SetEvents
+	started bool
+
+	// timer of the timeout of the current state
+	timer      Timer
+	timerState State
+	deadline   time.Time
+
+	// remaining is the time left on the timer when it was paused
+	remaining time.Duration
+}
+
+// entered is called after the machine entered the state with the
+// transition. It arms the timeout of the state and fires the automatic
+// and deferred events. The caller must hold the lock.
+func (sm *StateMachine) entered(ctx context.Context, state State, transitionID string) {
+	sm.armTimeout(state)
+
+	sm.automatic.started = true
+	if !sm.automatic.paused {
+		sm.fireAutomatic(ctx, transitionID)
+	}
+
+	sm.fireDeferred(ctx)
+}
+
+// armTimeout arms the timeout of the state, if it has one, replacing
+// the timer of the previous state. The caller must hold the lock.
+func (sm *StateMachine) armTimeout(state State) {
+	sm.stopTimer()
+
+	if timeout, ok := sm.timeouts[state]; ok {
+		sm.automatic.timerState = state
+		sm.automatic.deadline = sm.clock.Now().Add(timeout.After)
+		sm.automatic.remaining = timeout.After
+
+		if !sm.automatic.paused {
+			sm.startTimer(timeout.After)
+		}
+	}
+}
+
+// fireAutomatic fires the first automatic event, in name order, that
+// has a transition from the current state. The transitions are recorded
+// as caused by the transition with the ID, if any. The caller must hold
+// the lock.
+func (sm *StateMachine) fireAutomatic(ctx context.Context, causedBy string) {
+	for _, name := range sm.eventNames {
+		if !sm.events[name].Auto {
+			continue
+		}
+
+		sm.causedBy = causedBy
+		err := sm.fire(ctx, name)
+		sm.causedBy = ""
+
+		if err == nil {
+			return
+		}
+	}
+}
+
+func (sm *StateMachine) startTimer(d time.Duration) {
+	state := sm.automatic.timerState
+
+	var timer Timer
+	timer = sm.clock.AfterFunc(d, func() {
+		sm.lockFire()
+		defer sm.unlockFire()
+
+		// the timer was stopped or replaced while waiting for the lock
+		if sm.automatic.timer != timer {
+			return
+		}
+		sm.automatic.timer = nil
+		sm.automatic.timerState = ""
+
+		if sm.currentState != state {
+			return
+		}
+
+		event := sm.timeouts[state].Event
+
+		// there is no caller to return the error to, the error handler
+		// is the only one to see it
+		sm.handleError(event, sm.fire(context.Background(), event))
+	})
+
+	sm.automatic.timer = timer
+}
+
+func (sm *StateMachine) stopTimer() {
+	if sm.automatic.timer != nil {
+		sm.automatic.timer.Stop()
+		sm.automatic.timer = nil
+	}
+	sm.automatic.timerState = ""
+}
+
+// PauseAutomatic suspends the timeouts and the automatic events. Fire
+// keeps working while automatic transitions are paused.
+func (sm *StateMachine) PauseAutomatic() {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.automatic.paused {
+		return
+	}
+	sm.automatic.paused = true
+
+	if sm.automatic.timer != nil {
+		sm.automatic.timer.Stop()
+		sm.automatic.timer = nil
+		sm.automatic.remaining = sm.automatic.deadline.Sub(sm.clock.Now())
+	}
+}
+
+// ResumeAutomatic resumes the paused timeout with the time it had left
+// when it was paused and fires the automatic events of the current
+// state.
+func (sm *StateMachine) ResumeAutomatic() {
+	sm.lockFire()
+	defer sm.unlockFire()
+
+	if !sm.automatic.paused {
+		return
+	}
+	sm.automatic.paused = false
+
+	if sm.automatic.timerState != "" {
+		remaining := sm.automatic.remaining
+		if remaining < 0 {
+			remaining = 0
+		}
+		sm.automatic.deadline = sm.clock.Now().Add(remaining)
+		sm.startTimer(remaining)
+	}
+
+	sm.fireAutomatic(context.Background(), "")
+}
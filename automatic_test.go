@@ -0,0 +1,133 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPauseAutomatic(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+	clock := newFakeClock()
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		Clock:        clock,
+		Timeouts: map[State]Timeout{
+			StateAuthorized: {After: time.Hour, Event: "void"},
+		},
+	})
+	sm.SetEvents(transferEvents(xfr))
+
+	err := sm.Fire("authorize", 100)
+	require.NoError(t, err)
+
+	clock.Advance(30 * time.Minute)
+	sm.PauseAutomatic()
+
+	// the timeout doesn't fire while automatic transitions are paused
+	clock.Advance(2 * time.Hour)
+	require.Equal(t, StateAuthorized, sm.State())
+
+	sm.ResumeAutomatic()
+
+	// the timer resumes with the 30 minutes it had left
+	clock.Advance(29 * time.Minute)
+	require.Equal(t, StateAuthorized, sm.State())
+
+	clock.Advance(time.Minute)
+	require.Equal(t, StateVoided, sm.State())
+}
+
+func TestPauseAutomaticKeepsFireWorking(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	events := transferEvents(xfr)
+	capture := events["capture"]
+	capture.Auto = true
+	events["capture"] = capture
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(events)
+
+	sm.PauseAutomatic()
+
+	err := sm.Fire("authorize", 100)
+	require.NoError(t, err)
+	require.Equal(t, StateAuthorized, sm.State())
+
+	sm.ResumeAutomatic()
+	require.Equal(t, StateCaptured, sm.State())
+}
+
+func TestAutomaticCausedBy(t *testing.T) {
+	const StateSettled State = "settled"
+
+	events := transferEvents(&Transfer{})
+	events["capture"] = Event{
+		Auto:        true,
+		Transitions: []Transition{{From: StateAuthorized, To: StateCaptured}},
+	}
+	events["settle"] = Event{
+		Auto:        true,
+		Transitions: []Transition{{From: StateCaptured, To: StateSettled}},
+	}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		SubjectID:    "xfr",
+	})
+	sm.SetEvents(events)
+
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.Equal(t, StateSettled, sm.State())
+
+	history := sm.History()
+	require.Len(t, history, 3)
+
+	require.Regexp(t, `^xfr/[0-9a-f]{16}$`, history[0].ID)
+	require.NotEqual(t, history[0].ID, history[1].ID)
+	require.Empty(t, history[0].CausedBy)
+
+	require.Equal(t, "capture", history[1].Event)
+	require.Equal(t, history[0].ID, history[1].CausedBy)
+
+	require.Equal(t, "settle", history[2].Event)
+	require.Equal(t, history[1].ID, history[2].CausedBy)
+}
+
+func TestInitialStateAutomatic(t *testing.T) {
+	t.Run("timeout", func(t *testing.T) {
+		clock := newFakeClock()
+
+		sm := NewStateMachine(Options{
+			CurrentState: StateAuthorized,
+			Clock:        clock,
+			Timeouts: map[State]Timeout{
+				StateAuthorized: {After: time.Hour, Event: "void"},
+			},
+		})
+		sm.SetEvents(transferEvents(&Transfer{AuthorizedAmount: 100}))
+
+		clock.Advance(time.Hour)
+		require.Equal(t, StateVoided, sm.State())
+	})
+
+	t.Run("automatic event", func(t *testing.T) {
+		events := transferEvents(&Transfer{})
+		capture := events["capture"]
+		capture.Auto = true
+		events["capture"] = capture
+
+		sm := NewStateMachine(Options{
+			CurrentState: StateAuthorized,
+		})
+		sm.SetEvents(events)
+
+		require.Equal(t, StateCaptured, sm.State())
+		require.Len(t, sm.History(), 1)
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// batchKey is the context key of the batch ID
+type batchKey struct{}
+
+// StartBatch returns a context labeling the fires made with it, on one
+// or several machines, with a new batch ID. The ID is recorded in the
+// history, passed to Telemetry and to Metrics implementing
+// BatchMetrics, so the fires of one business operation can be
+// correlated.
+func StartBatch(ctx context.Context) (context.Context, string) {
+	id := randomID()
+
+	return context.WithValue(ctx, batchKey{}, id), id
+}
+
+// randomID returns a random hex ID
+func randomID() string {
+	var b [8]byte
+	// crypto/rand.Read doesn't fail on supported platforms
+	_, _ = rand.Read(b[:])
+
+	return hex.EncodeToString(b[:])
+}
+
+// BatchID returns the ID of the batch started by StartBatch, or an
+// empty string if the context is not part of a batch
+func BatchID(ctx context.Context) string {
+	id, _ := ctx.Value(batchKey{}).(string)
+	return id
+}
+
+// BatchMetrics is implemented by Metrics that correlate the
+// transitions of a batch. It's called in addition to
+// TransitionCompleted for fires within a batch.
+type BatchMetrics interface {
+	BatchTransitionCompleted(batchID, event, from, to string)
+}
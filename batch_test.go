@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// batchRecorder records the batches of the completed transitions
+type batchRecorder struct {
+	failureRecorder
+	batches []string
+}
+
+func (r *batchRecorder) BatchTransitionCompleted(batchID, event, from, to string) {
+	r.batches = append(r.batches, batchID+":"+event)
+}
+
+func TestBatch(t *testing.T) {
+	metrics := &batchRecorder{}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		Metrics:      metrics,
+	})
+	sm.SetEvents(transferEvents(&Transfer{}))
+
+	ctx, batchID := StartBatch(context.Background())
+	require.NotEmpty(t, batchID)
+	require.Equal(t, batchID, BatchID(ctx))
+
+	require.NoError(t, sm.FireContext(ctx, "authorize", 100))
+	require.NoError(t, sm.FireContext(ctx, "capture"))
+
+	history := sm.History()
+	require.Len(t, history, 2)
+	require.Equal(t, batchID, history[0].BatchID)
+	require.Equal(t, batchID, history[1].BatchID)
+
+	require.Equal(t, []string{batchID + ":authorize", batchID + ":capture"}, metrics.batches)
+
+	_, otherID := StartBatch(context.Background())
+	require.NotEqual(t, batchID, otherID)
+	require.Empty(t, BatchID(context.Background()))
+}
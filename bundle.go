@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// bundleVersion is the version of the bundle format
+const bundleVersion = 1
+
+// Bundle is everything needed to reconstruct the behavior of a machine,
+// except for the functions, which are referenced by name, see
+// handlerName
+type Bundle struct {
+	Version int               `json:"version"`
+	Initial State             `json:"initial"`
+	Current State             `json:"current"`
+	States  []State           `json:"states"`
+	Events  []BundleEvent     `json:"events"`
+	History []BundleRecord    `json:"history,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+type BundleEvent struct {
+	Name        string             `json:"name"`
+	Auto        bool               `json:"auto,omitempty"`
+	Disabled    bool               `json:"disabled,omitempty"`
+	Feature     string             `json:"feature,omitempty"`
+	Idempotent  bool               `json:"idempotent,omitempty"`
+	ArgsSchema  ArgsSchema         `json:"args_schema,omitempty"`
+	Transitions []BundleTransition `json:"transitions"`
+}
+
+type BundleTransition struct {
+	From      State      `json:"from"`
+	To        State      `json:"to"`
+	Weight    float64    `json:"weight,omitempty"`
+	RateLimit *RateLimit `json:"rate_limit,omitempty"`
+
+	// Handlers maps the function fields of the transition, e.g. Guard
+	// or On, to the names they are registered under in the Registry
+	Handlers map[string]string `json:"handlers,omitempty"`
+}
+
+// BundleRecord is a TransitionRecord of the history. Args are
+// formatted as strings as they can be of any type.
+type BundleRecord struct {
+	Event    string   `json:"event"`
+	From     State    `json:"from"`
+	To       State    `json:"to"`
+	Args     []string `json:"args,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// ExportBundle serializes the definition and the runtime state of the
+// machine as a JSON bundle. Functions of the transitions are exported
+// as references named by handlerName. OnContext, AfterContext and
+// Effects can't be registered, so a machine using them is not
+// exported, see exportable.
+func (sm *StateMachine) ExportBundle() ([]byte, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	bundle := Bundle{
+		Version: bundleVersion,
+		Initial: sm.initialState,
+		Current: sm.currentState,
+		States:  sm.states(),
+		Meta:    sm.meta,
+	}
+
+	for _, name := range sm.eventNames {
+		event := sm.events[name]
+
+		if err := exportable(name, event); err != nil {
+			return nil, err
+		}
+
+		bundleEvent := BundleEvent{
+			Name:       name,
+			Auto:       event.Auto,
+			Disabled:   event.Disabled,
+			Feature:    event.Feature,
+			Idempotent: event.Idempotent,
+			ArgsSchema: event.ArgsSchema,
+		}
+
+		for _, transition := range event.Transitions {
+			bundleEvent.Transitions = append(bundleEvent.Transitions, BundleTransition{
+				From:      transition.From,
+				To:        transition.To,
+				Weight:    transition.Weight,
+				RateLimit: transition.RateLimit,
+				Handlers:  handlerNames(name, transition),
+			})
+		}
+
+		bundle.Events = append(bundle.Events, bundleEvent)
+	}
+
+	for _, record := range sm.history {
+		args := make([]string, len(record.Args))
+		for i, arg := range record.Args {
+			args[i] = fmt.Sprint(arg)
+		}
+
+		bundle.History = append(bundle.History, BundleRecord{
+			Event:    record.Event,
+			From:     record.From,
+			To:       record.To,
+			Args:     args,
+			Warnings: record.Warnings,
+		})
+	}
+
+	return json.MarshalIndent(bundle, "", "  ")
+}
+
+// exportable returns an error if the event has functions that can't be
+// referenced by name from a Registry, so exporting would silently drop
+// them
+func exportable(name string, event Event) error {
+	for _, transition := range event.Transitions {
+		switch {
+		case transition.OnContext != nil, transition.AfterContext != nil:
+			return fmt.Errorf("event %s from %s to %s: OnContext and AfterContext can't be exported", name, transition.From, transition.To)
+		case len(transition.Effects) != 0:
+			return fmt.Errorf("event %s from %s to %s: Effects can't be exported", name, transition.From, transition.To)
+		}
+	}
+
+	return nil
+}
+
+// handlerNames returns the names of the function fields that are set
+func handlerNames(event string, transition Transition) map[string]string {
+	handlers := map[string]string{}
+
+	for field, set := range map[string]bool{
+		"Guard":        transition.Guard != nil,
+		"ContextGuard": transition.ContextGuard != nil,
+		"SoftGuard":    transition.SoftGuard != nil,
+		"On":           transition.On != nil,
+		"After":        transition.After != nil,
+	} {
+		if set {
+			handlers[field] = handlerName(event, transition, field)
+		}
+	}
+
+	if len(handlers) == 0 {
+		return nil
+	}
+
+	return handlers
+}
+
+// ImportBundle reconstructs the machine exported by ExportBundle. The
+// function fields are resolved by name from the registry when they are
+// called. The imported machine keeps its state in memory.
+func ImportBundle(data []byte, reg *Registry) (*StateMachine, error) {
+	var bundle Bundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("decoding bundle: %w", err)
+	}
+
+	if bundle.Version != bundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", bundle.Version)
+	}
+
+	events := make(map[string]Event, len(bundle.Events))
+	for _, bundleEvent := range bundle.Events {
+		event := Event{
+			Auto:       bundleEvent.Auto,
+			Disabled:   bundleEvent.Disabled,
+			Feature:    bundleEvent.Feature,
+			Idempotent: bundleEvent.Idempotent,
+			ArgsSchema: bundleEvent.ArgsSchema,
+		}
+
+		for _, bundleTransition := range bundleEvent.Transitions {
+			transition := Transition{
+				From:      bundleTransition.From,
+				To:        bundleTransition.To,
+				Weight:    bundleTransition.Weight,
+				RateLimit: bundleTransition.RateLimit,
+			}
+
+			for field, name := range bundleTransition.Handlers {
+				switch field {
+				case "Guard":
+					transition.Guard = reg.Guard(name)
+				case "ContextGuard":
+					transition.ContextGuard = reg.ContextGuard(name)
+				case "SoftGuard":
+					transition.SoftGuard = reg.SoftGuard(name)
+				case "On":
+					transition.On = reg.Action(name)
+				case "After":
+					transition.After = reg.Action(name)
+				default:
+					return nil, fmt.Errorf("event %s: unknown handler field %s", bundleEvent.Name, field)
+				}
+			}
+
+			event.Transitions = append(event.Transitions, transition)
+		}
+
+		events[bundleEvent.Name] = event
+	}
+
+	sm := NewStateMachine(Options{
+		CurrentState: bundle.Current,
+		Meta:         bundle.Meta,
+	})
+	sm.initialState = bundle.Initial
+	sm.SetEvents(events)
+
+	for _, record := range bundle.History {
+		args := make([]any, len(record.Args))
+		for i, arg := range record.Args {
+			args[i] = arg
+		}
+
+		sm.history = append(sm.history, TransitionRecord{
+			Event:    record.Event,
+			From:     record.From,
+			To:       record.To,
+			Args:     args,
+			Warnings: record.Warnings,
+		})
+	}
+
+	return sm, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		Meta:         map[string]string{"service": "transfers"},
+	})
+	sm.SetEvents(transferEvents(xfr))
+
+	require.NoError(t, sm.Fire("authorize", 100))
+
+	data, err := sm.ExportBundle()
+	require.NoError(t, err)
+
+	// the handlers of the imported machine work on a copy of the
+	// transfer
+	imported := &Transfer{ID: "xfr", AuthorizedAmount: 100}
+	events := transferEvents(imported)
+
+	reg := NewRegistry()
+	for name, event := range events {
+		for _, transition := range event.Transitions {
+			if transition.Guard != nil {
+				reg.RegisterGuard(handlerName(name, transition, "Guard"), transition.Guard)
+			}
+			if transition.On != nil {
+				reg.RegisterAction(handlerName(name, transition, "On"), transition.On)
+			}
+		}
+	}
+
+	restored, err := ImportBundle(data, reg)
+	require.NoError(t, err)
+
+	require.Equal(t, StateAuthorized, restored.State())
+	require.Equal(t, map[string]string{"service": "transfers"}, restored.Meta())
+	require.Equal(t, []TransitionRecord{
+		{Event: "authorize", From: StatePending, To: StateAuthorized, Args: []any{"100"}},
+	}, restored.History())
+
+	require.NoError(t, restored.Fire("void", 50))
+	require.Equal(t, StatePartiallyAuthorized, restored.State())
+	require.Equal(t, 50, imported.AuthorizedAmount)
+
+	// the definition survives the round trip
+	fresh, err := ImportBundle(data, reg)
+	require.NoError(t, err)
+	require.Equal(t, sm.Describe(), fresh.Describe())
+}
+
+func TestBundleSchemaAndRateLimit(t *testing.T) {
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(map[string]Event{
+		"authorize": {
+			ArgsSchema: ArgsSchema{{Name: "amount", Type: "int", Required: true}},
+			Transitions: []Transition{{
+				From:      StatePending,
+				To:        StateAuthorized,
+				RateLimit: &RateLimit{Rate: 1, Burst: 1},
+			}},
+		},
+	})
+
+	data, err := sm.ExportBundle()
+	require.NoError(t, err)
+
+	restored, err := ImportBundle(data, NewRegistry())
+	require.NoError(t, err)
+
+	event := restored.events["authorize"]
+	require.Equal(t, ArgsSchema{{Name: "amount", Type: "int", Required: true}}, event.ArgsSchema)
+	require.Equal(t, &RateLimit{Rate: 1, Burst: 1}, event.Transitions[0].RateLimit)
+}
+
+func TestBundleUnexportable(t *testing.T) {
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(map[string]Event{
+		"authorize": {
+			Transitions: []Transition{{
+				From: StatePending,
+				To:   StateAuthorized,
+				OnContext: func(ctx context.Context, args ...any) error {
+					return nil
+				},
+			}},
+		},
+	})
+
+	_, err := sm.ExportBundle()
+	require.EqualError(t, err, "event authorize from pending to authorized: OnContext and AfterContext can't be exported")
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// StateCache caches the states of the subjects loaded from the
+// Repository so reads don't hit the database every time
+type StateCache interface {
+	// Get returns the cached state of the subject and true if it's
+	// present and not expired
+	Get(id string) (State, bool)
+
+	// Set caches the state of the subject
+	Set(id string, state State)
+
+	// Invalidate removes the subject from the cache
+	Invalidate(id string)
+}
+
+type cacheEntry struct {
+	state     State
+	expiresAt time.Time
+}
+
+// MemoryStateCache is an in-memory StateCache that keeps entries for
+// the configured TTL. Entries expire by the Options.Clock of the
+// machine the cache is passed to, or by the system clock.
+type MemoryStateCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cacheEntry
+	clock   Clock
+}
+
+func NewMemoryStateCache(ttl time.Duration) *MemoryStateCache {
+	return &MemoryStateCache{
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+		clock:   realClock{},
+	}
+}
+
+// useClock makes the cache expire entries by the clock
+func (c *MemoryStateCache) useClock(clock Clock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.clock = clock
+}
+
+func (c *MemoryStateCache) Get(id string) (State, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[id]
+	if !ok {
+		return "", false
+	}
+
+	if !c.clock.Now().Before(entry.expiresAt) {
+		delete(c.entries, id)
+		return "", false
+	}
+
+	return entry.state, true
+}
+
+func (c *MemoryStateCache) Set(id string, state State) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[id] = cacheEntry{
+		state:     state,
+		expiresAt: c.clock.Now().Add(c.ttl),
+	}
+}
+
+func (c *MemoryStateCache) Invalidate(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, id)
+}
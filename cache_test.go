@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateCache(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+	repo := newFakeRepository(map[string]State{"xfr": StatePending})
+
+	sm := NewStateMachine(Options{
+		Repository: repo,
+		SubjectID:  xfr.ID,
+		StateCache: NewMemoryStateCache(time.Minute),
+	})
+	sm.SetEvents(transferEvents(xfr))
+
+	require.Equal(t, StatePending, sm.State())
+	require.Equal(t, StatePending, sm.State())
+	require.Equal(t, StatePending, sm.State())
+	require.Equal(t, 1, repo.loads)
+
+	err := sm.Fire("authorize", 100)
+	require.NoError(t, err)
+
+	// Fire loads the state from the repository, bypassing the cache,
+	// and the state is then served from the cache refreshed by Fire
+	require.Equal(t, 2, repo.loads)
+	require.Equal(t, StateAuthorized, sm.State())
+	require.Equal(t, 2, repo.loads)
+	require.Equal(t, StateAuthorized, repo.states["xfr"])
+}
+
+func TestStateCacheIgnoredByFire(t *testing.T) {
+	repo := newFakeRepository(map[string]State{"xfr": StatePending})
+
+	sm := NewStateMachine(Options{
+		Repository: repo,
+		SubjectID:  "xfr",
+		StateCache: NewMemoryStateCache(time.Minute),
+	})
+	sm.SetEvents(transferEvents(&Transfer{}))
+
+	require.Equal(t, StatePending, sm.State())
+
+	// another process moved the subject on
+	repo.states["xfr"] = StateCaptured
+
+	require.ErrorIs(t, sm.Fire("authorize", 100), ErrNoTransitionForEvent)
+	require.Equal(t, StateCaptured, repo.states["xfr"])
+}
+
+func TestMemoryStateCacheTTL(t *testing.T) {
+	clock := newFakeClock()
+	repo := newFakeRepository(map[string]State{"xfr": StateAuthorized})
+	cache := NewMemoryStateCache(time.Minute)
+
+	sm := NewStateMachine(Options{
+		Repository: repo,
+		SubjectID:  "xfr",
+		StateCache: cache,
+		Clock:      clock,
+	})
+
+	require.Equal(t, StateAuthorized, sm.State())
+
+	state, ok := cache.Get("xfr")
+	require.True(t, ok)
+	require.Equal(t, StateAuthorized, state)
+
+	// expired by the clock of the machine
+	clock.Advance(time.Minute)
+
+	_, ok = cache.Get("xfr")
+	require.False(t, ok)
+}
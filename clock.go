@@ -0,0 +1,30 @@
+package main
+
+import "time"
+
+// Clock tells the time and schedules timers. It's injected via Options
+// so time-dependent behavior can be tested with a fake clock.
+type Clock interface {
+	Now() time.Time
+
+	// AfterFunc calls f in its own goroutine after the duration
+	// elapses
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a timer scheduled by the Clock
+type Timer interface {
+	// Stop prevents the timer from firing. It returns false if the
+	// timer has already fired or been stopped.
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strings"
+)
+
+//go:generate go run . compile -bundle testdata/transfer_bundle.json -pkg main -type compiledTransfer -out compiled_transfer_test.go
+
+// Machine is implemented by StateMachine and by the machines generated
+// by ToCompiledSource, so callers can swap one for the other
+type Machine interface {
+	Fire(name string, args ...any) error
+	State() State
+}
+
+var _ Machine = (*StateMachine)(nil)
+
+// compiledHandler is a function field of a transition stored in a
+// field of the compiled machine
+type compiledHandler struct {
+	field  string
+	name   string
+	lookup string
+	typ    string
+}
+
+// ToCompiledSource generates Go source declaring typeName, a machine
+// firing the events of this one with switch statements instead of map
+// lookups. The guards and actions are resolved once from a Registry by
+// the names returned by handlerName when the compiled machine is
+// created. Only events with Guard, On and After functions can be
+// compiled; state hierarchies are not supported.
+func (sm *StateMachine) ToCompiledSource(pkg, typeName string) (string, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.hierarchical {
+		return "", fmt.Errorf("hierarchical states are not supported by compiled machines")
+	}
+
+	var handlers []compiledHandler
+	fields := make(map[string]string)
+
+	handler := func(event string, transition Transition, field, lookup, typ string) string {
+		name := handlerName(event, transition, field)
+		if f, ok := fields[name]; ok {
+			return f
+		}
+
+		f := fmt.Sprintf("%s%d", strings.ToLower(field), len(handlers))
+		fields[name] = f
+		handlers = append(handlers, compiledHandler{field: f, name: name, lookup: lookup, typ: typ})
+
+		return f
+	}
+
+	var fire bytes.Buffer
+
+	for _, name := range sm.eventNames {
+		event := sm.events[name]
+
+		if err := compilable(name, event); err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(&fire, "case %q:\n", name)
+
+		if event.Disabled {
+			fmt.Fprintf(&fire, "return fmt.Errorf(\"event %%s: %%w\", name, ErrEventDisabled)\n")
+			continue
+		}
+
+		// transitions are grouped by their from state, keeping their
+		// order, as the first allowed one is taken
+		var froms []State
+		byFrom := make(map[State][]Transition)
+		for _, transition := range event.Transitions {
+			if _, ok := byFrom[transition.From]; !ok {
+				froms = append(froms, transition.From)
+			}
+			byFrom[transition.From] = append(byFrom[transition.From], transition)
+		}
+
+		fmt.Fprintf(&fire, "switch m.state {\n")
+		for _, from := range froms {
+			fmt.Fprintf(&fire, "case %q:\n", from)
+
+			for _, transition := range byFrom[from] {
+				var guard string
+				if transition.Guard != nil {
+					guard = handler(name, transition, "Guard", "LookupGuard", "func(args ...any) bool")
+				}
+
+				on, after := "nil", "nil"
+				if transition.On != nil {
+					on = "m." + handler(name, transition, "On", "LookupAction", "func(args ...any) error")
+				}
+				if transition.After != nil {
+					after = "m." + handler(name, transition, "After", "LookupAction", "func(args ...any) error")
+				}
+
+				call := fmt.Sprintf("return m.transition(%q, %q, %s, %s, args)\n", from, transition.To, on, after)
+
+				if guard == "" {
+					// the following transitions are never taken
+					fire.WriteString(call)
+					break
+				}
+
+				fmt.Fprintf(&fire, "if m.%s(args...) {\n%s}\n", guard, call)
+			}
+		}
+		fmt.Fprintf(&fire, "}\n")
+		fmt.Fprintf(&fire, "return fmt.Errorf(\"event %%s: %%w\", name, ErrNoTransitionForEvent)\n")
+	}
+
+	constructor := "New" + typeName
+	if first := typeName[:1]; first == strings.ToLower(first) {
+		constructor = "new" + strings.ToUpper(first) + typeName[1:]
+	}
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "// Code generated by ToCompiledSource. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	fmt.Fprintf(&buf, "import (\n\"errors\"\n\"fmt\"\n\"sync\"\n)\n\n")
+
+	fmt.Fprintf(&buf, "// %s is a compiled state machine. It fires the events with switch\n", typeName)
+	fmt.Fprintf(&buf, "// statements instead of looking up the transitions.\n")
+	fmt.Fprintf(&buf, "type %s struct {\n", typeName)
+	fmt.Fprintf(&buf, "mu sync.Mutex\n")
+	fmt.Fprintf(&buf, "state State\n\n")
+	for _, h := range handlers {
+		fmt.Fprintf(&buf, "// %s\n%s %s\n", h.name, h.field, h.typ)
+	}
+	fmt.Fprintf(&buf, "}\n\n")
+
+	fmt.Fprintf(&buf, "var _ Machine = (*%s)(nil)\n\n", typeName)
+
+	fmt.Fprintf(&buf, "// %s returns the compiled machine in the state with the guards\n", constructor)
+	fmt.Fprintf(&buf, "// and actions resolved from the registry\n")
+	fmt.Fprintf(&buf, "func %s(state State, registry *Registry) (*%s, error) {\n", constructor, typeName)
+	fmt.Fprintf(&buf, "m := &%s{state: state}\n\n", typeName)
+	if len(handlers) > 0 {
+		fmt.Fprintf(&buf, "var err error\n")
+	}
+	for _, h := range handlers {
+		fmt.Fprintf(&buf, "if m.%s, err = registry.%s(%q); err != nil {\nreturn nil, err\n}\n", h.field, h.lookup, h.name)
+	}
+	fmt.Fprintf(&buf, "\nreturn m, nil\n}\n\n")
+
+	fmt.Fprintf(&buf, "// State returns the current state of the machine\n")
+	fmt.Fprintf(&buf, "func (m *%s) State() State {\n", typeName)
+	fmt.Fprintf(&buf, "m.mu.Lock()\ndefer m.mu.Unlock()\n\nreturn m.state\n}\n\n")
+
+	fmt.Fprintf(&buf, "// Fire triggers the event and changes the state of the machine\n")
+	fmt.Fprintf(&buf, "func (m *%s) Fire(name string, args ...any) error {\n", typeName)
+	fmt.Fprintf(&buf, "m.mu.Lock()\ndefer m.mu.Unlock()\n\n")
+	fmt.Fprintf(&buf, "switch name {\n")
+	buf.Write(fire.Bytes())
+	fmt.Fprintf(&buf, "}\n\nreturn ErrEventNotFound\n}\n\n")
+
+	fmt.Fprintf(&buf, "func (m *%s) transition(from, to State, on, after func(args ...any) error, args []any) error {\n", typeName)
+	buf.WriteString(`changed := true
+
+if on != nil {
+	if err := on(args...); err != nil {
+		if !errors.Is(err, ErrNoChange) {
+			return fmt.Errorf("error during transition from %s to %s: %w", from, to, err)
+		}
+		changed = false
+	}
+}
+
+m.state = to
+
+if after != nil && changed {
+	if err := after(args...); err != nil {
+		return fmt.Errorf("error calling after function: %w", err)
+	}
+}
+
+return nil
+}
+`)
+
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("formatting generated source: %w", err)
+	}
+
+	return string(source), nil
+}
+
+// compilable returns an error if the event uses features the compiled
+// machine doesn't support
+func compilable(name string, event Event) error {
+	switch {
+	case event.Auto:
+		return fmt.Errorf("event %s: automatic events are not supported by compiled machines", name)
+	case event.Feature != "":
+		return fmt.Errorf("event %s: features are not supported by compiled machines", name)
+	case event.ArgsSchema != nil:
+		return fmt.Errorf("event %s: args schemas are not supported by compiled machines", name)
+	}
+
+	for _, transition := range event.Transitions {
+		switch {
+		case transition.OnContext != nil, transition.AfterContext != nil:
+			return fmt.Errorf("event %s from %s to %s: OnContext and AfterContext are not supported by compiled machines", name, transition.From, transition.To)
+		case transition.ContextGuard != nil, transition.SoftGuard != nil:
+			return fmt.Errorf("event %s from %s to %s: context and soft guards are not supported by compiled machines", name, transition.From, transition.To)
+		case len(transition.Effects) != 0, transition.RateLimit != nil:
+			return fmt.Errorf("event %s from %s to %s: Effects and RateLimit are not supported by compiled machines", name, transition.From, transition.To)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// transferRegistry registers the guards and actions of transferEvents
+// under their handler names
+func transferRegistry(xfr *Transfer) *Registry {
+	registry := NewRegistry()
+
+	for name, event := range transferEvents(xfr) {
+		for _, transition := range event.Transitions {
+			if transition.Guard != nil {
+				registry.RegisterGuard(handlerName(name, transition, "Guard"), transition.Guard)
+			}
+			if transition.On != nil {
+				registry.RegisterAction(handlerName(name, transition, "On"), transition.On)
+			}
+			if transition.After != nil {
+				registry.RegisterAction(handlerName(name, transition, "After"), transition.After)
+			}
+		}
+	}
+
+	return registry
+}
+
+func TestCompiledSourceUpToDate(t *testing.T) {
+	sm := NewStateMachine(Options{CurrentState: StatePending})
+	sm.SetEvents(transferEvents(&Transfer{}))
+
+	source, err := sm.ToCompiledSource("main", "compiledTransfer")
+	require.NoError(t, err)
+
+	generated, err := os.ReadFile("compiled_transfer_test.go")
+	require.NoError(t, err)
+
+	require.Equal(t, string(generated), source, "run go generate")
+}
+
+func TestCompiledMachineMatchesInterpreted(t *testing.T) {
+	sequences := map[string][]struct {
+		event string
+		args  []any
+	}{
+		"capture":       {{"authorize", []any{100}}, {"capture", nil}},
+		"partial void":  {{"authorize", []any{100}}, {"void", []any{40}}, {"void", []any{60}}},
+		"full void":     {{"authorize", []any{100}}, {"void", nil}, {"capture", nil}},
+		"void too much": {{"authorize", []any{100}}, {"void", []any{150}}},
+		"capture early": {{"capture", nil}, {"authorize", []any{100}}, {"authorize", []any{100}}},
+		"unknown event": {{"refund", nil}},
+		"no args":       {{"authorize", nil}, {"void", nil}},
+	}
+
+	for name, sequence := range sequences {
+		t.Run(name, func(t *testing.T) {
+			interpretedXfr := &Transfer{ID: "xfr"}
+			interpreted := NewStateMachine(Options{CurrentState: StatePending})
+			interpreted.SetEvents(transferEvents(interpretedXfr))
+
+			compiledXfr := &Transfer{ID: "xfr"}
+			compiled, err := newCompiledTransfer(StatePending, transferRegistry(compiledXfr))
+			require.NoError(t, err)
+
+			for _, fire := range sequence {
+				interpretedErr := interpreted.Fire(fire.event, fire.args...)
+				compiledErr := compiled.Fire(fire.event, fire.args...)
+
+				require.Equal(t, interpretedErr, compiledErr, "event %s", fire.event)
+				require.Equal(t, interpreted.State(), compiled.State(), "event %s", fire.event)
+				require.Equal(t, interpretedXfr, compiledXfr, "event %s", fire.event)
+			}
+		})
+	}
+}
+
+func TestCompiledMachineMissingHandler(t *testing.T) {
+	_, err := newCompiledTransfer(StatePending, NewRegistry())
+	require.ErrorIs(t, err, ErrHandlerNotFound)
+}
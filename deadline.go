@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Overdue reports whether the machine stayed in the current state past
+// the deadline computed by Options.MustLeaveBy, the state and how long
+// ago the deadline passed. States without a deadline are never
+// overdue. The state of a machine loaded from the repository is
+// considered entered when the machine was created.
+func (sm *StateMachine) Overdue() (bool, State, time.Duration) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	current, err := sm.loadState(context.Background())
+	if err != nil {
+		current = sm.currentState
+	}
+
+	mustLeaveBy, ok := sm.mustLeaveBy[current]
+	if !ok {
+		return false, current, 0
+	}
+
+	overdue := sm.clock.Now().Sub(mustLeaveBy(sm.enteredAt))
+	if overdue <= 0 {
+		return false, current, 0
+	}
+
+	return true, current, overdue
+}
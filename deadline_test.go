@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverdue(t *testing.T) {
+	clock := newFakeClock()
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		Clock:        clock,
+		MustLeaveBy: map[State]func(time.Time) time.Time{
+			StatePending: func(enteredAt time.Time) time.Time {
+				return enteredAt.Add(24 * time.Hour)
+			},
+		},
+	})
+	sm.SetEvents(transferEvents(&Transfer{}))
+
+	clock.Advance(23 * time.Hour)
+
+	overdue, state, by := sm.Overdue()
+	require.False(t, overdue)
+	require.Equal(t, StatePending, state)
+	require.Zero(t, by)
+
+	clock.Advance(3 * time.Hour)
+
+	overdue, state, by = sm.Overdue()
+	require.True(t, overdue)
+	require.Equal(t, StatePending, state)
+	require.Equal(t, 2*time.Hour, by)
+
+	require.NoError(t, sm.Fire("authorize", 100))
+
+	overdue, state, _ = sm.Overdue()
+	require.False(t, overdue)
+	require.Equal(t, StateAuthorized, state)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+type deferredEvent struct {
+	name      string
+	args      []any
+	expiresAt time.Time
+}
+
+// FireDeferred fires the event if it's permitted from the current
+// state. Otherwise the event is queued and retried after every
+// successful transition until it fires or its DeferredTTL expires.
+//
+// Deferred events are retried in the order they were deferred. After
+// one of them fires, the remaining ones are retried again from the
+// oldest, so an event deferred earlier always gets the first chance to
+// fire in the new state. An event that is permitted but fails is
+// dropped and its error goes to the error handler.
+func (sm *StateMachine) FireDeferred(name string, args ...any) error {
+	sm.lockFire()
+	defer sm.unlockFire()
+
+	event, ok := sm.events[name]
+	if !ok {
+		return sm.handleError(name, ErrEventNotFound)
+	}
+
+	current, err := sm.loadState(context.Background())
+	if err != nil {
+		return sm.handleError(name, err)
+	}
+
+	if _, rejected := sm.gate(sm.guardContext(context.Background(), name, current), event, args, nil); rejected == nil {
+		return sm.handleError(name, sm.fire(context.Background(), name, args...))
+	}
+
+	deferred := deferredEvent{name: name, args: args}
+	if sm.deferredTTL > 0 {
+		deferred.expiresAt = sm.clock.Now().Add(sm.deferredTTL)
+	}
+	sm.deferred = append(sm.deferred, deferred)
+
+	return nil
+}
+
+// fireDeferred fires the deferred events that became permitted. The
+// caller must hold the lock.
+func (sm *StateMachine) fireDeferred(ctx context.Context) {
+	// events fired from here retry the queue themselves otherwise
+	if sm.firingDeferred {
+		return
+	}
+	sm.firingDeferred = true
+	defer func() { sm.firingDeferred = false }()
+
+	for sm.fireNextDeferred(ctx) {
+	}
+}
+
+// fireNextDeferred fires the oldest deferred event that is permitted
+// and drops the expired ones. It returns false if none was fired.
+func (sm *StateMachine) fireNextDeferred(ctx context.Context) bool {
+	now := sm.clock.Now()
+
+	var pending []deferredEvent
+	for i, deferred := range sm.deferred {
+		if !deferred.expiresAt.IsZero() && !now.Before(deferred.expiresAt) {
+			continue
+		}
+
+		_, rejected := sm.gate(sm.guardContext(ctx, deferred.name, sm.currentState), sm.events[deferred.name], deferred.args, nil)
+		if rejected != nil {
+			pending = append(pending, deferred)
+			continue
+		}
+
+		sm.deferred = append(pending, sm.deferred[i+1:]...)
+
+		err := sm.fire(ctx, deferred.name, deferred.args...)
+		sm.handleError(deferred.name, err)
+
+		return true
+	}
+
+	sm.deferred = pending
+
+	return false
+}
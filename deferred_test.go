@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFireDeferred(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(transferEvents(xfr))
+
+	// capture arrives before the authorization
+	require.NoError(t, sm.FireDeferred("capture"))
+	require.Equal(t, StatePending, sm.State())
+
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.Equal(t, StateCaptured, sm.State())
+
+	var events []string
+	for _, record := range sm.History() {
+		events = append(events, record.Event)
+	}
+	require.Equal(t, []string{"authorize", "capture"}, events)
+
+	require.ErrorIs(t, sm.FireDeferred("refund"), ErrEventNotFound)
+}
+
+func TestFireDeferredExpires(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+	clock := newFakeClock()
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		Clock:        clock,
+		DeferredTTL:  time.Minute,
+	})
+	sm.SetEvents(transferEvents(xfr))
+
+	require.NoError(t, sm.FireDeferred("capture"))
+
+	clock.Advance(time.Minute)
+
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.Equal(t, StateAuthorized, sm.State())
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Definition declares a machine in YAML or JSON, so services sharing a
+// lifecycle don't have to copy the events around. Guards and actions
+// are referenced by the names they are registered under in a Registry.
+//
+//	initial: pending
+//	states: [pending, authorized, captured]
+//	events:
+//	  - name: authorize
+//	    transitions:
+//	      - from: pending
+//	        to: authorized
+//	        on: authorize
+type Definition struct {
+	Initial State             `yaml:"initial"`
+	States  []State           `yaml:"states"`
+	Events  []DefinitionEvent `yaml:"events"`
+	Meta    map[string]string `yaml:"meta"`
+}
+
+type DefinitionEvent struct {
+	Name        string                 `yaml:"name"`
+	Auto        bool                   `yaml:"auto"`
+	Disabled    bool                   `yaml:"disabled"`
+	Feature     string                 `yaml:"feature"`
+	Idempotent  bool                   `yaml:"idempotent"`
+	Transitions []DefinitionTransition `yaml:"transitions"`
+}
+
+type DefinitionTransition struct {
+	From   State   `yaml:"from"`
+	To     State   `yaml:"to"`
+	Weight float64 `yaml:"weight"`
+
+	// Guard, ContextGuard, On and After are the names of the guards
+	// and the actions in the Registry. ContextGuard can name a field
+	// guard registered by RegisterFieldGuards.
+	Guard        string `yaml:"guard"`
+	ContextGuard string `yaml:"contextGuard"`
+	On           string `yaml:"on"`
+	After        string `yaml:"after"`
+
+	// FieldGuard is a field guard declared inline, compiled against
+	// the subject of the machine. It can't be combined with
+	// ContextGuard.
+	FieldGuard *FieldGuard `yaml:"fieldGuard"`
+}
+
+// guarded returns true if the transition has a guard
+func (t DefinitionTransition) guarded() bool {
+	return t.Guard != "" || t.ContextGuard != "" || t.FieldGuard != nil
+}
+
+// contextGuard resolves the context guard of the transition from the
+// registry or compiles its field guard against the subject. It returns
+// nil if the transition has neither.
+func (t DefinitionTransition) contextGuard(reg *Registry, subject any) (func(gc GuardContext, args ...any) bool, error) {
+	switch {
+	case t.ContextGuard != "" && t.FieldGuard != nil:
+		return nil, fmt.Errorf("both contextGuard and fieldGuard are set")
+	case t.ContextGuard != "":
+		return reg.LookupContextGuard(t.ContextGuard)
+	case t.FieldGuard != nil:
+		return CompileFieldGuard(*t.FieldGuard, subject)
+	default:
+		return nil, nil
+	}
+}
+
+// LoadDefinition builds a machine from the YAML or JSON definition.
+// The guards and actions must be registered in the registry when the
+// definition is loaded and inline field guards are compiled against
+// opts.Subject. The definition is validated, see Definition.Validate.
+// The machine starts in the initial state unless opts sets the current
+// state.
+func LoadDefinition(data []byte, reg *Registry, opts Options) (*StateMachine, error) {
+	var def Definition
+	if err := yaml.Unmarshal(data, &def); err != nil {
+		return nil, fmt.Errorf("decoding definition: %w", err)
+	}
+
+	if err := def.Validate(reg, opts.Subject); err != nil {
+		return nil, err
+	}
+
+	events := make(map[string]Event, len(def.Events))
+	for _, defEvent := range def.Events {
+		event := Event{
+			Auto:       defEvent.Auto,
+			Disabled:   defEvent.Disabled,
+			Feature:    defEvent.Feature,
+			Idempotent: defEvent.Idempotent,
+		}
+
+		for _, defTransition := range defEvent.Transitions {
+			transition := Transition{
+				From:   defTransition.From,
+				To:     defTransition.To,
+				Weight: defTransition.Weight,
+			}
+
+			// the handlers are known to be registered and the field
+			// guards to compile
+			if defTransition.Guard != "" {
+				transition.Guard, _ = reg.LookupGuard(defTransition.Guard)
+			}
+			transition.ContextGuard, _ = defTransition.contextGuard(reg, opts.Subject)
+			if defTransition.On != "" {
+				transition.On, _ = reg.LookupAction(defTransition.On)
+			}
+			if defTransition.After != "" {
+				transition.After, _ = reg.LookupAction(defTransition.After)
+			}
+
+			event.Transitions = append(event.Transitions, transition)
+		}
+
+		events[defEvent.Name] = event
+	}
+
+	if opts.CurrentState == "" {
+		opts.CurrentState = def.Initial
+	}
+	if opts.Meta == nil {
+		opts.Meta = def.Meta
+	}
+
+	sm := NewStateMachine(opts)
+	sm.initialState = def.Initial
+	sm.SetEvents(events)
+
+	return sm, nil
+}
+
+// Validate checks that the definition only uses declared states,
+// registered handlers and field guards that compile against the
+// subject, that every state is reachable from the initial state, and
+// that an event has at most one transition from a state unless all
+// transitions from the state are guarded. It returns a
+// *ValidationError listing all problems.
+func (def Definition) Validate(reg *Registry, subject any) error {
+	var problems []string
+
+	declared := make(map[State]bool, len(def.States))
+	for _, state := range def.States {
+		if declared[state] {
+			problems = append(problems, fmt.Sprintf("state %s is declared more than once", state))
+		}
+		declared[state] = true
+	}
+
+	if def.Initial == "" {
+		problems = append(problems, "initial state is missing")
+	} else if !declared[def.Initial] {
+		problems = append(problems, fmt.Sprintf("initial state %s is not declared", def.Initial))
+	}
+
+	names := map[string]bool{}
+	next := map[State][]State{}
+
+	for _, event := range def.Events {
+		if event.Name == "" {
+			problems = append(problems, "event without name")
+		} else if names[event.Name] {
+			problems = append(problems, fmt.Sprintf("event %s is declared more than once", event.Name))
+		}
+		names[event.Name] = true
+
+		from := map[State][]DefinitionTransition{}
+
+		for _, transition := range event.Transitions {
+			for _, state := range []State{transition.From, transition.To} {
+				if !declared[state] {
+					problems = append(problems, fmt.Sprintf("event %s: transition from %s to %s: unknown state %q", event.Name, transition.From, transition.To, state))
+				}
+			}
+
+			if transition.Guard != "" {
+				if _, err := reg.LookupGuard(transition.Guard); err != nil {
+					problems = append(problems, fmt.Sprintf("event %s: transition from %s to %s: %s", event.Name, transition.From, transition.To, err))
+				}
+			}
+
+			if _, err := transition.contextGuard(reg, subject); err != nil {
+				problems = append(problems, fmt.Sprintf("event %s: transition from %s to %s: %s", event.Name, transition.From, transition.To, err))
+			}
+
+			for _, action := range []string{transition.On, transition.After} {
+				if action == "" {
+					continue
+				}
+				if _, err := reg.LookupAction(action); err != nil {
+					problems = append(problems, fmt.Sprintf("event %s: transition from %s to %s: %s", event.Name, transition.From, transition.To, err))
+				}
+			}
+
+			from[transition.From] = append(from[transition.From], transition)
+			next[transition.From] = append(next[transition.From], transition.To)
+		}
+
+		for _, state := range sortedStates(from) {
+			transitions := from[state]
+			if len(transitions) < 2 {
+				continue
+			}
+
+			for _, transition := range transitions {
+				if !transition.guarded() {
+					problems = append(problems, fmt.Sprintf("event %s: %d transitions from %s, but not all are guarded", event.Name, len(transitions), state))
+					break
+				}
+			}
+		}
+	}
+
+	if declared[def.Initial] {
+		reachable := map[State]bool{def.Initial: true}
+		queue := []State{def.Initial}
+
+		for len(queue) > 0 {
+			state := queue[0]
+			queue = queue[1:]
+
+			for _, to := range next[state] {
+				if !reachable[to] {
+					reachable[to] = true
+					queue = append(queue, to)
+				}
+			}
+		}
+
+		for _, state := range def.States {
+			if !reachable[state] {
+				problems = append(problems, fmt.Sprintf("state %s is unreachable from %s", state, def.Initial))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
+
+// sortedStates returns the keys of the map, sorted
+func sortedStates[T any](m map[State]T) []State {
+	states := make([]State, 0, len(m))
+	for state := range m {
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i] < states[j] })
+
+	return states
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// transferDefinitionRegistry registers the handlers of the transfer
+// definition in testdata
+func transferDefinitionRegistry(xfr *Transfer) *Registry {
+	reg := NewRegistry()
+
+	reg.RegisterAction("authorize", func(args ...any) error {
+		amount, err := ArgInt(args, 0)
+		if err != nil {
+			return err
+		}
+		xfr.AuthorizedAmount = amount
+
+		return nil
+	})
+	reg.RegisterAction("void", func(args ...any) error {
+		amount, err := ArgInt(args, 0)
+		if err != nil {
+			return err
+		}
+		xfr.VoidedAmount += amount
+		xfr.AuthorizedAmount -= amount
+
+		return nil
+	})
+	reg.RegisterGuard("partial", func(args ...any) bool {
+		amount, err := ArgInt(args, 0)
+		return err == nil && amount < xfr.AuthorizedAmount
+	})
+	reg.RegisterGuard("full", func(args ...any) bool {
+		amount, err := ArgInt(args, 0)
+		return err == nil && amount == xfr.AuthorizedAmount
+	})
+
+	return reg
+}
+
+func TestLoadDefinition(t *testing.T) {
+	data, err := os.ReadFile("testdata/transfer_definition.yaml")
+	require.NoError(t, err)
+
+	xfr := &Transfer{}
+
+	sm, err := LoadDefinition(data, transferDefinitionRegistry(xfr), Options{})
+	require.NoError(t, err)
+	require.Equal(t, StatePending, sm.State())
+	require.Equal(t, "transfers", sm.Meta()["service"])
+
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.NoError(t, sm.Fire("void", 40))
+	require.Equal(t, StatePartiallyAuthorized, sm.State())
+	require.Equal(t, 60, xfr.AuthorizedAmount)
+
+	require.NoError(t, sm.Fire("capture"))
+	require.Equal(t, StateCaptured, sm.State())
+
+	require.Equal(t, `stateDiagram-v2
+    [*] --> captured
+    pending --> authorized : authorize
+    authorized --> captured : capture
+    partially_authorized --> captured : capture
+    authorized --> partially_authorized : void [guarded]
+    authorized --> voided : void [guarded]
+`, sm.ExportMermaid())
+
+	t.Run("json", func(t *testing.T) {
+		sm, err := LoadDefinition([]byte(`{
+			"initial": "pending",
+			"states": ["pending", "authorized"],
+			"events": [
+				{"name": "authorize", "transitions": [{"from": "pending", "to": "authorized"}]}
+			]
+		}`), NewRegistry(), Options{CurrentState: StateAuthorized})
+		require.NoError(t, err)
+		require.Equal(t, StateAuthorized, sm.State())
+		require.Contains(t, sm.ExportDOT(), `"pending" -> "authorized" [label="authorize"];`)
+	})
+}
+
+func TestLoadDefinitionContextGuards(t *testing.T) {
+	xfr := &Transfer{}
+
+	reg := transferDefinitionRegistry(xfr)
+	require.NoError(t, reg.RegisterFieldGuards([]byte(`{
+		"partial": {"field": "AuthorizedAmount", "op": ">", "argIndex": 0}
+	}`), xfr))
+
+	sm, err := LoadDefinition([]byte(`
+initial: pending
+states: [pending, authorized, partially_authorized, voided]
+events:
+  - name: authorize
+    transitions:
+      - from: pending
+        to: authorized
+        on: authorize
+  - name: void
+    transitions:
+      - from: authorized
+        to: partially_authorized
+        contextGuard: partial
+        on: void
+      - from: authorized
+        to: voided
+        fieldGuard: {field: AuthorizedAmount, op: "==", argIndex: 0}
+        on: void
+`), reg, Options{Subject: xfr})
+	require.NoError(t, err)
+
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.ErrorIs(t, sm.Fire("void", 150), ErrNoTransitionForEvent)
+	require.NoError(t, sm.Fire("void", 100))
+	require.Equal(t, StateVoided, sm.State())
+
+	_, err = LoadDefinition([]byte(`
+initial: pending
+states: [pending, authorized]
+events:
+  - name: authorize
+    transitions:
+      - from: pending
+        to: authorized
+        contextGuard: unknown
+      - from: pending
+        to: authorized
+        fieldGuard: {field: Amount, op: ">"}
+      - from: pending
+        to: authorized
+        contextGuard: partial
+        fieldGuard: {field: AuthorizedAmount, op: ">"}
+`), reg, Options{Subject: xfr})
+
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.Equal(t, []string{
+		`event authorize: transition from pending to authorized: context guard unknown: handler not found`,
+		`event authorize: transition from pending to authorized: field guard Amount: no exported field in main.Transfer`,
+		`event authorize: transition from pending to authorized: both contextGuard and fieldGuard are set`,
+	}, validationErr.Problems)
+}
+
+func TestLoadDefinitionValidation(t *testing.T) {
+	_, err := LoadDefinition([]byte(`
+initial: pending
+states: [pending, authorized, captured, voided]
+events:
+  - name: authorize
+    transitions:
+      - from: pending
+        to: authorized
+        on: authorize
+      - from: pending
+        to: declined
+  - name: void
+    transitions:
+      - from: authorized
+        to: voided
+        guard: full
+`), NewRegistry(), Options{})
+
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.Equal(t, []string{
+		`event authorize: transition from pending to authorized: action authorize: handler not found`,
+		`event authorize: transition from pending to declined: unknown state "declined"`,
+		`event authorize: 2 transitions from pending, but not all are guarded`,
+		`event void: transition from authorized to voided: guard full: handler not found`,
+		`state captured is unreachable from pending`,
+	}, validationErr.Problems)
+
+	_, err = LoadDefinition([]byte(`initial: [`), NewRegistry(), Options{})
+	require.ErrorContains(t, err, "decoding definition")
+}
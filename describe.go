@@ -0,0 +1,52 @@
+package main
+
+// EventDescription describes an event for documentation and tooling
+type EventDescription struct {
+	Name string
+
+	// Idempotent events are safe to retry
+	Idempotent bool
+
+	Auto        bool
+	Disabled    bool
+	Feature     string
+	Transitions []TransitionDescription
+}
+
+type TransitionDescription struct {
+	From    State
+	To      State
+	Guarded bool
+}
+
+// Describe returns the description of the events of the machine,
+// sorted by name
+func (sm *StateMachine) Describe() []EventDescription {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	descriptions := make([]EventDescription, 0, len(sm.events))
+	for _, name := range sm.eventNames {
+		event := sm.events[name]
+
+		description := EventDescription{
+			Name:       name,
+			Idempotent: event.Idempotent,
+			Auto:       event.Auto,
+			Disabled:   event.Disabled,
+			Feature:    event.Feature,
+		}
+
+		for _, transition := range event.Transitions {
+			description.Transitions = append(description.Transitions, TransitionDescription{
+				From:    transition.From,
+				To:      transition.To,
+				Guarded: transition.guarded(),
+			})
+		}
+
+		descriptions = append(descriptions, description)
+	}
+
+	return descriptions
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDescribe(t *testing.T) {
+	events := transferEvents(&Transfer{})
+	capture := events["capture"]
+	capture.Idempotent = true
+	events["capture"] = capture
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(events)
+
+	require.Equal(t, []EventDescription{
+		{
+			Name: "authorize",
+			Transitions: []TransitionDescription{
+				{From: StatePending, To: StateAuthorized},
+			},
+		},
+		{
+			Name:       "capture",
+			Idempotent: true,
+			Transitions: []TransitionDescription{
+				{From: StateAuthorized, To: StateCaptured},
+			},
+		},
+		{
+			Name: "void",
+			Transitions: []TransitionDescription{
+				{From: StateAuthorized, To: StatePartiallyAuthorized, Guarded: true},
+				{From: StateAuthorized, To: StateVoided, Guarded: true},
+			},
+		},
+	}, sm.Describe())
+}
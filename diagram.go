@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// diagramEdge is a transition as drawn in a diagram
+type diagramEdge struct {
+	from  State
+	to    State
+	label string
+}
+
+// diagram returns the current state and the edges of the diagram of
+// the machine, ordered by event name and then by transition order.
+// Guarded transitions are labeled "<event> [guarded]". The caller must
+// hold the lock.
+func (sm *StateMachine) diagram() (State, []diagramEdge) {
+	current, err := sm.loadState(context.Background())
+	if err != nil {
+		current = sm.currentState
+	}
+
+	var edges []diagramEdge
+	for _, name := range sm.eventNames {
+		for _, transition := range sm.events[name].Transitions {
+			label := name
+			if transition.guarded() {
+				label += " [guarded]"
+			}
+
+			edges = append(edges, diagramEdge{
+				from:  transition.From,
+				to:    transition.To,
+				label: label,
+			})
+		}
+	}
+
+	return current, edges
+}
+
+// ExportMermaid returns the transition graph as a Mermaid
+// stateDiagram-v2 with the current state as the initial one, e.g.
+//
+//	stateDiagram-v2
+//	    [*] --> pending
+//	    pending --> authorized : authorize
+//
+// The output is deterministic, so it can be kept in version control.
+func (sm *StateMachine) ExportMermaid() string {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	current, edges := sm.diagram()
+
+	var b strings.Builder
+
+	b.WriteString("stateDiagram-v2\n")
+	if current != "" {
+		fmt.Fprintf(&b, "    [*] --> %s\n", current)
+	}
+	for _, edge := range edges {
+		fmt.Fprintf(&b, "    %s --> %s : %s\n", edge.from, edge.to, edge.label)
+	}
+
+	return b.String()
+}
+
+// ExportDOT returns the transition graph in the Graphviz DOT language.
+// The current state is pointed to by an arrow from a start point, as
+// in ExportMermaid.
+func (sm *StateMachine) ExportDOT() string {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	current, edges := sm.diagram()
+
+	var b strings.Builder
+
+	b.WriteString("digraph fsm {\n")
+	if current != "" {
+		b.WriteString("\tstart [shape=point];\n")
+		fmt.Fprintf(&b, "\tstart -> %q;\n", current)
+	}
+	for _, edge := range edges {
+		fmt.Fprintf(&b, "\t%q -> %q [label=%q];\n", edge.from, edge.to, edge.label)
+	}
+	b.WriteString("}\n")
+
+	return b.String()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportMermaid(t *testing.T) {
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(transferEvents(&Transfer{}))
+
+	require.Equal(t, `stateDiagram-v2
+    [*] --> pending
+    pending --> authorized : authorize
+    authorized --> captured : capture
+    authorized --> partially_authorized : void [guarded]
+    authorized --> voided : void [guarded]
+`, sm.ExportMermaid())
+
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.Contains(t, sm.ExportMermaid(), "[*] --> authorized\n")
+}
+
+func TestExportDOT(t *testing.T) {
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(transferEvents(&Transfer{}))
+
+	require.Equal(t, `digraph fsm {
+	start [shape=point];
+	start -> "pending";
+	"pending" -> "authorized" [label="authorize"];
+	"authorized" -> "captured" [label="capture"];
+	"authorized" -> "partially_authorized" [label="void [guarded]"];
+	"authorized" -> "voided" [label="void [guarded]"];
+}
+`, sm.ExportDOT())
+}
+
+func TestExportsAreDeterministic(t *testing.T) {
+	events := map[string]Event{}
+	for _, name := range []string{"void", "capture", "refund", "authorize", "settle"} {
+		events[name] = Event{
+			Transitions: []Transition{{From: StateAuthorized, To: State("after_" + name)}},
+		}
+	}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StateAuthorized,
+	})
+	sm.SetEvents(events)
+
+	mermaid := sm.ExportMermaid()
+	source, err := sm.ToGoSource("transfers", "events")
+	require.NoError(t, err)
+	bundle, err := sm.ExportBundle()
+	require.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		require.Equal(t, mermaid, sm.ExportMermaid())
+		require.Equal(t, sm.ExportDOT(), sm.ExportDOT())
+		require.Equal(t, sm.ToSQLSeed("transitions"), sm.ToSQLSeed("transitions"))
+
+		repeated, err := sm.ToGoSource("transfers", "events")
+		require.NoError(t, err)
+		require.Equal(t, source, repeated)
+
+		repeatedBundle, err := sm.ExportBundle()
+		require.NoError(t, err)
+		require.Equal(t, bundle, repeatedBundle)
+	}
+
+	require.Equal(t, `stateDiagram-v2
+    [*] --> authorized
+    authorized --> after_authorize : authorize
+    authorized --> after_capture : capture
+    authorized --> after_refund : refund
+    authorized --> after_settle : settle
+    authorized --> after_void : void
+`, mermaid)
+}
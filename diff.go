@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// FieldChange is a field of the subject changed by a transition
+type FieldChange struct {
+	Field  string
+	Before any
+	After  any
+}
+
+// SubjectDiff lists the fields of the subject changed by a transition
+type SubjectDiff []FieldChange
+
+// snapshot returns a deep copy of the subject if diffs are enabled
+// and the subject can be cloned
+func (sm *StateMachine) snapshot(subject any) any {
+	if !sm.diffSubject {
+		return nil
+	}
+
+	cloner, ok := subject.(Cloner)
+	if !ok {
+		return nil
+	}
+
+	return cloner.Clone()
+}
+
+// diffSubjects compares the exported fields of two structs, or
+// pointers to structs, of the same type. Fields are compared as a
+// whole, without descending into nested structs.
+func diffSubjects(before, after any) (SubjectDiff, error) {
+	b := reflect.Indirect(reflect.ValueOf(before))
+	a := reflect.Indirect(reflect.ValueOf(after))
+
+	if b.Kind() != reflect.Struct || a.Type() != b.Type() {
+		return nil, fmt.Errorf("can't diff %T and %T", before, after)
+	}
+
+	var diff SubjectDiff
+	for i := 0; i < b.NumField(); i++ {
+		field := b.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		bv, av := b.Field(i).Interface(), a.Field(i).Interface()
+		if !reflect.DeepEqual(bv, av) {
+			diff = append(diff, FieldChange{Field: field.Name, Before: bv, After: av})
+		}
+	}
+
+	return diff, nil
+}
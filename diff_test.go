@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubjectDiff(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	var diffs []SubjectDiff
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		Subject:      xfr,
+		OnDiff: func(diff SubjectDiff) error {
+			diffs = append(diffs, diff)
+			return nil
+		},
+	})
+	sm.SetEvents(transferEvents(xfr))
+
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.NoError(t, sm.Fire("void", 50))
+
+	expected := SubjectDiff{
+		{Field: "AuthorizedAmount", Before: 100, After: 50},
+		{Field: "VoidedAmount", Before: 0, After: 50},
+	}
+
+	require.Len(t, diffs, 2)
+	require.Equal(t, expected, diffs[1])
+	require.Equal(t, expected, sm.History()[1].Diff)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+var ErrDispatcherShutdown = fmt.Errorf("dispatcher shut down")
+
+// DispatcherOptions configures a Dispatcher
+type DispatcherOptions struct {
+	// Machine returns the machine of the subject the events are fired
+	// on. It's called from the goroutine of the subject.
+	Machine func(subjectID string) (*StateMachine, error)
+
+	// ErrorHandler is called with the errors of the queued events, which
+	// can't be returned to the caller of Enqueue
+	ErrorHandler func(subjectID, event string, err error)
+}
+
+// queuedEvent is an event waiting in the queue of a subject
+type queuedEvent struct {
+	name string
+	args []any
+}
+
+// Dispatcher processes events in the order they were enqueued per
+// subject, one at a time, while the events of different subjects are
+// processed concurrently
+type Dispatcher struct {
+	mu           sync.Mutex
+	machine      func(subjectID string) (*StateMachine, error)
+	errorHandler func(subjectID, event string, err error)
+	queues       map[string][]queuedEvent
+	shutdown     bool
+	wg           sync.WaitGroup
+}
+
+// NewDispatcher returns a dispatcher firing the events on the machines
+// returned by opts.Machine
+func NewDispatcher(opts DispatcherOptions) *Dispatcher {
+	return &Dispatcher{
+		machine:      opts.Machine,
+		errorHandler: opts.ErrorHandler,
+		queues:       make(map[string][]queuedEvent),
+	}
+}
+
+// Enqueue adds the event to the queue of the subject. A goroutine is
+// started for the subject if its queue was empty; it exits once the
+// queue is drained.
+func (d *Dispatcher) Enqueue(subjectID string, name string, args ...any) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.shutdown {
+		return ErrDispatcherShutdown
+	}
+
+	queue, running := d.queues[subjectID]
+	d.queues[subjectID] = append(queue, queuedEvent{name: name, args: args})
+
+	if !running {
+		d.wg.Add(1)
+		go d.process(subjectID)
+	}
+
+	return nil
+}
+
+// process fires the queued events of the subject until its queue is
+// empty
+func (d *Dispatcher) process(subjectID string) {
+	defer d.wg.Done()
+
+	for {
+		d.mu.Lock()
+		queue := d.queues[subjectID]
+		if len(queue) == 0 {
+			delete(d.queues, subjectID)
+			d.mu.Unlock()
+			return
+		}
+		event := queue[0]
+		d.queues[subjectID] = queue[1:]
+		d.mu.Unlock()
+
+		err := d.dispatch(subjectID, event)
+		if err != nil && d.errorHandler != nil {
+			d.errorHandler(subjectID, event.name, err)
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch(subjectID string, event queuedEvent) error {
+	sm, err := d.machine(subjectID)
+	if err != nil {
+		return fmt.Errorf("getting machine of %s: %w", subjectID, err)
+	}
+
+	return sm.Fire(event.name, event.args...)
+}
+
+// Shutdown stops accepting events and waits until the queued ones are
+// processed or the context is done
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.mu.Lock()
+	d.shutdown = true
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
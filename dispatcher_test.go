@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatcherProcessesInOrder(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	var mu sync.Mutex
+	var processed []string
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		OnTransition: func(record TransitionRecord) {
+			mu.Lock()
+			defer mu.Unlock()
+			processed = append(processed, record.Event)
+		},
+	})
+	sm.SetEvents(transferEvents(xfr))
+
+	var errs []error
+	dispatcher := NewDispatcher(DispatcherOptions{
+		Machine: func(subjectID string) (*StateMachine, error) {
+			return sm, nil
+		},
+		ErrorHandler: func(subjectID, event string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		},
+	})
+
+	require.NoError(t, dispatcher.Enqueue("xfr", "authorize", 100))
+	require.NoError(t, dispatcher.Enqueue("xfr", "capture"))
+
+	require.NoError(t, dispatcher.Shutdown(context.Background()))
+
+	require.Empty(t, errs)
+	require.Equal(t, []string{"authorize", "capture"}, processed)
+	require.Equal(t, StateCaptured, sm.State())
+
+	require.ErrorIs(t, dispatcher.Enqueue("xfr", "void"), ErrDispatcherShutdown)
+}
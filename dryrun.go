@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// FireStep is an event to fire with its args
+type FireStep struct {
+	Event string
+	Args  []any
+}
+
+// DryRunSequence previews firing the steps in order. The steps run
+// against a copy of the subject, like Project, so the state and the
+// subject of the machine don't change and only OnContext is called,
+// not After or the effects. A step with On but no OnContext fails with
+// ErrNotProjectable. It returns the state after each step. It stops at
+// the first step that fails, returning the states of the steps before
+// it and an error identifying the step.
+func (sm *StateMachine) DryRunSequence(steps []FireStep) ([]State, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	current, err := sm.loadState(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("loading state: %w", err)
+	}
+
+	var projected any
+	if cloner, ok := sm.subject.(Cloner); ok {
+		projected = cloner.Clone()
+	} else if sm.subject != nil {
+		return nil, ErrSubjectNotCloneable
+	}
+
+	states := make([]State, 0, len(steps))
+	for i, step := range steps {
+		to, err := sm.project(context.Background(), step.Event, current, projected, step.Args)
+		if err != nil {
+			return states, fmt.Errorf("step %d (%s): %w", i, step.Event, err)
+		}
+
+		states = append(states, to)
+		current = to
+	}
+
+	return states, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRunSequence(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		Subject:      xfr,
+	})
+	sm.SetEvents(transferSubjectEvents(xfr))
+
+	states, err := sm.DryRunSequence([]FireStep{
+		{Event: "authorize", Args: []any{100}},
+		{Event: "capture"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []State{StateAuthorized, StateCaptured}, states)
+
+	// nothing changed
+	require.Equal(t, StatePending, sm.State())
+	require.Equal(t, &Transfer{ID: "xfr"}, xfr)
+	require.Empty(t, sm.History())
+
+	states, err = sm.DryRunSequence([]FireStep{
+		{Event: "authorize", Args: []any{100}},
+		{Event: "capture"},
+		{Event: "void"},
+	})
+	require.ErrorIs(t, err, ErrNoTransitionForEvent)
+	require.EqualError(t, err, "step 2 (void): event void: no transition for event")
+	require.Equal(t, []State{StateAuthorized, StateCaptured}, states)
+}
+
+func TestDryRunSequenceRequiresOnContext(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		Subject:      xfr,
+	})
+	sm.SetEvents(transferEvents(xfr))
+
+	states, err := sm.DryRunSequence([]FireStep{
+		{Event: "authorize", Args: []any{100}},
+	})
+	require.ErrorIs(t, err, ErrNotProjectable)
+	require.Empty(t, states)
+	require.Equal(t, &Transfer{ID: "xfr"}, xfr)
+}
@@ -0,0 +1,52 @@
+package main
+
+import "fmt"
+
+// edge is a pair of states traversed by a transition
+type edge struct {
+	from State
+	to   State
+}
+
+// OnEdge registers fn to be called after every transition from one
+// state to the other, whatever the event. Edge handlers are called
+// after After, in the order they were registered, and are skipped when
+// After is, e.g. when On returned ErrNoChange. The first error is
+// returned by Fire unless After failed.
+func (sm *StateMachine) OnEdge(from, to State, fn func(args ...any) error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.edgeHandlers == nil {
+		sm.edgeHandlers = make(map[edge][]func(args ...any) error)
+	}
+
+	key := edge{from: from, to: to}
+	sm.edgeHandlers[key] = append(sm.edgeHandlers[key], fn)
+}
+
+// hasEdgeHandlers returns true if handlers are registered for the edge.
+// The caller must hold the lock.
+func (sm *StateMachine) hasEdgeHandlers(from, to State) bool {
+	return len(sm.edgeHandlers[edge{from: from, to: to}]) > 0
+}
+
+// callEdgeHandlers calls the handlers of the edge without holding the
+// lock, see unlocked. The caller must hold the lock.
+func (sm *StateMachine) callEdgeHandlers(event string, from, to State, args []any) error {
+	var firstErr error
+
+	for _, fn := range sm.edgeHandlers[edge{from: from, to: to}] {
+		var err error
+		sm.unlocked(func() {
+			err = sm.protect(event, "OnEdge", func() error {
+				return fn(args...)
+			})
+		})
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error calling edge handler from %s to %s: %w", from, to, err)
+		}
+	}
+
+	return firstErr
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnEdge(t *testing.T) {
+	newMachine := func(released *[]int) *StateMachine {
+		xfr := &Transfer{ID: "xfr"}
+
+		sm := NewStateMachine(Options{
+			CurrentState: StatePending,
+		})
+		sm.SetEvents(transferEvents(xfr))
+		sm.OnEdge(StateAuthorized, StateVoided, func(args ...any) error {
+			*released = append(*released, xfr.VoidedAmount)
+			return nil
+		})
+
+		return sm
+	}
+
+	var released []int
+
+	sm := newMachine(&released)
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.NoError(t, sm.Fire("void", 40))
+	require.Empty(t, released)
+
+	sm = newMachine(&released)
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.NoError(t, sm.Fire("void"))
+	require.Equal(t, []int{100}, released)
+}
+
+func TestOnEdgeError(t *testing.T) {
+	var calls []string
+
+	sm := NewStateMachine(Options{
+		CurrentState: StateAuthorized,
+	})
+	sm.SetEvents(map[string]Event{
+		"capture": {
+			Transitions: []Transition{{
+				From: StateAuthorized,
+				To:   StateCaptured,
+				After: func(args ...any) error {
+					calls = append(calls, "after")
+					return nil
+				},
+			}},
+		},
+	})
+	sm.OnEdge(StateAuthorized, StateCaptured, func(args ...any) error {
+		calls = append(calls, "edge")
+		return fmt.Errorf("hold not found")
+	})
+
+	err := sm.Fire("capture")
+	require.EqualError(t, err, "error calling edge handler from authorized to captured: hold not found")
+	require.Equal(t, []string{"after", "edge"}, calls)
+
+	// the transition is committed even if the edge handler failed
+	require.Equal(t, StateCaptured, sm.State())
+}
@@ -0,0 +1,152 @@
+package main
+
+import "fmt"
+
+// Effect is a named side effect executed after the transition is
+// committed, e.g. publishing an event or notifying the customer
+type Effect struct {
+	Name string
+
+	// Run executes the effect. The key identifies the delivery of the
+	// effect for a transition and stays the same across retries, so
+	// receivers can deduplicate it.
+	Run func(key string, args ...any) error
+
+	// Retry defines how many times Run is attempted right after the
+	// transition. Without it, Run is attempted once.
+	Retry *RetryPolicy
+}
+
+type EffectStatus string
+
+const (
+	EffectDelivered EffectStatus = "delivered"
+	EffectFailed    EffectStatus = "failed"
+)
+
+// EffectDelivery tracks the delivery of an effect of a transition
+type EffectDelivery struct {
+	Key      string
+	Event    string
+	Effect   string
+	Status   EffectStatus
+	Attempts int
+	Err      error
+
+	effect Effect
+	args   []any
+}
+
+// runEffects executes the effects of the committed transition in
+// order. A failing effect doesn't prevent the next ones from running.
+// The deliveries of the previous transitions are pruned first, except
+// for the failed ones. The caller must hold the lock.
+func (sm *StateMachine) runEffects(transitionID, event string, transition Transition, args []any) {
+	sm.pruneEffects()
+
+	for _, effect := range transition.Effects {
+		delivery := &EffectDelivery{
+			Key:    fmt.Sprintf("%s/%s", transitionID, effect.Name),
+			Event:  event,
+			Effect: effect.Name,
+			effect: effect,
+			args:   args,
+		}
+
+		attempts := 1
+		if effect.Retry != nil && effect.Retry.MaxAttempts > 1 {
+			attempts = effect.Retry.MaxAttempts
+		}
+
+		for i := 0; i < attempts; i++ {
+			if i > 0 && effect.Retry.Backoff > 0 {
+				sm.unlocked(func() {
+					sm.sleep(effect.Retry.Backoff)
+				})
+			}
+
+			if sm.deliver(delivery) {
+				break
+			}
+		}
+
+		sm.effects = append(sm.effects, delivery)
+	}
+}
+
+// deliver attempts to run the effect without holding the lock and
+// records the outcome. The caller must hold the lock.
+func (sm *StateMachine) deliver(delivery *EffectDelivery) bool {
+	delivery.Attempts++
+
+	var err error
+	sm.unlocked(func() {
+		err = sm.protect(delivery.Event, "Effect "+delivery.Effect, func() error {
+			return delivery.effect.Run(delivery.Key, delivery.args...)
+		})
+	})
+	if err != nil {
+		delivery.Status = EffectFailed
+		delivery.Err = err
+		return false
+	}
+
+	delivery.Status = EffectDelivered
+	delivery.Err = nil
+
+	return true
+}
+
+// pruneEffects drops the delivered effects, so only the failed ones
+// are kept for RetryEffects. The caller must hold the lock.
+func (sm *StateMachine) pruneEffects() {
+	kept := sm.effects[:0]
+	for _, delivery := range sm.effects {
+		if delivery.Status != EffectDelivered {
+			kept = append(kept, delivery)
+		}
+	}
+
+	// the dropped deliveries are released
+	for i := len(kept); i < len(sm.effects); i++ {
+		sm.effects[i] = nil
+	}
+
+	sm.effects = kept
+}
+
+// Effects returns the deliveries of the effects of the last transition
+// and the failed deliveries of the previous ones, oldest first.
+// Delivered effects are pruned at the next transition.
+func (sm *StateMachine) Effects() []EffectDelivery {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	deliveries := make([]EffectDelivery, len(sm.effects))
+	for i, delivery := range sm.effects {
+		deliveries[i] = *delivery
+	}
+
+	return deliveries
+}
+
+// RetryEffects attempts once more every failed effect, without running
+// the transitions again. It returns the number of effects still
+// failing.
+func (sm *StateMachine) RetryEffects() int {
+	sm.lockFire()
+	defer sm.unlockFire()
+
+	var failed int
+	for _, delivery := range sm.effects {
+		if delivery.Status != EffectFailed {
+			continue
+		}
+
+		if !sm.deliver(delivery) {
+			failed++
+		}
+	}
+
+	return failed
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEffects(t *testing.T) {
+	var ran []string
+	publishCalls := 0
+	notifyCalls := 0
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		SubjectID:    "xfr",
+	})
+	sm.SetEvents(map[string]Event{
+		"authorize": {
+			Transitions: []Transition{
+				{
+					From: StatePending,
+					To:   StateAuthorized,
+					Effects: []Effect{
+						{
+							Name:  "publish",
+							Retry: &RetryPolicy{MaxAttempts: 2},
+							Run: func(key string, args ...any) error {
+								publishCalls++
+								if publishCalls == 1 {
+									return fmt.Errorf("broker unavailable")
+								}
+								ran = append(ran, "publish "+key)
+								return nil
+							},
+						},
+						{
+							Name: "notify",
+							Run: func(key string, args ...any) error {
+								notifyCalls++
+								if notifyCalls == 1 {
+									return fmt.Errorf("mailer down")
+								}
+								ran = append(ran, "notify "+key)
+								return nil
+							},
+						},
+						{
+							Name: "cache",
+							Run: func(key string, args ...any) error {
+								ran = append(ran, "cache "+key)
+								return nil
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	require.NoError(t, sm.Fire("authorize"))
+	require.Equal(t, StateAuthorized, sm.State())
+
+	// the keys are based on the ID of the transition
+	id := sm.History()[0].ID
+
+	// publish was retried, notify failed and cache still ran
+	require.Equal(t, []string{"publish " + id + "/publish", "cache " + id + "/cache"}, ran)
+
+	effects := sm.Effects()
+	require.Len(t, effects, 3)
+	require.Equal(t, EffectDelivered, effects[0].Status)
+	require.Equal(t, 2, effects[0].Attempts)
+	require.Equal(t, EffectFailed, effects[1].Status)
+	require.EqualError(t, effects[1].Err, "mailer down")
+	require.Equal(t, EffectDelivered, effects[2].Status)
+
+	// only the failed effect is retried
+	require.Equal(t, 0, sm.RetryEffects())
+	require.Equal(t, []string{"publish " + id + "/publish", "cache " + id + "/cache", "notify " + id + "/notify"}, ran)
+	require.Equal(t, EffectDelivered, sm.Effects()[1].Status)
+	require.Len(t, sm.History(), 1)
+}
+
+func TestEffectsPruned(t *testing.T) {
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		SubjectID:    "xfr",
+	})
+
+	delivered := Effect{Name: "publish", Run: func(key string, args ...any) error { return nil }}
+	failing := Effect{Name: "notify", Run: func(key string, args ...any) error { return fmt.Errorf("mailer down") }}
+
+	sm.SetEvents(map[string]Event{
+		"authorize": {
+			Transitions: []Transition{{
+				From:    StatePending,
+				To:      StateAuthorized,
+				Effects: []Effect{delivered, failing},
+			}},
+		},
+		"capture": {
+			Transitions: []Transition{{
+				From:    StateAuthorized,
+				To:      StateCaptured,
+				Effects: []Effect{delivered},
+			}},
+		},
+	})
+
+	require.NoError(t, sm.Fire("authorize"))
+	require.Len(t, sm.Effects(), 2)
+
+	require.NoError(t, sm.Fire("capture"))
+
+	// the delivered effect of the authorization is pruned, the failed
+	// one is kept for RetryEffects
+	history := sm.History()
+	var keys []string
+	for _, delivery := range sm.Effects() {
+		keys = append(keys, delivery.Key)
+	}
+	require.Equal(t, []string{history[0].ID + "/notify", history[1].ID + "/publish"}, keys)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+var ErrMachineClosed = fmt.Errorf("state machine closed")
+
+// EventChannelPolicy defines what happens when the channel returned by
+// Events is full
+type EventChannelPolicy int
+
+const (
+	// EventChannelDrop drops the event when the channel is full
+	EventChannelDrop EventChannelPolicy = iota
+
+	// EventChannelBlock blocks the transition until the event is
+	// received. Other fires wait meanwhile, so a slow consumer slows
+	// down all fires.
+	EventChannelBlock
+)
+
+// TransitionEvent describes a successful transition
+type TransitionEvent struct {
+	Event string
+	From  State
+	To    State
+	Args  []any
+	At    time.Time
+}
+
+// Events returns the channel receiving every successful transition. The
+// channel is created on the first call and closed by Close.
+func (sm *StateMachine) Events() <-chan TransitionEvent {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.eventCh == nil {
+		sm.eventCh = make(chan TransitionEvent, sm.eventChBuffer)
+		if sm.closed {
+			close(sm.eventCh)
+		}
+	}
+
+	return sm.eventCh
+}
+
+// emit sends the transition to the events channel according to the
+// configured policy, without holding the lock. The caller must hold
+// the lock.
+func (sm *StateMachine) emit(event TransitionEvent) {
+	ch := sm.eventCh
+	if ch == nil {
+		return
+	}
+
+	if sm.eventChPolicy == EventChannelBlock {
+		sm.unlocked(func() {
+			ch <- event
+		})
+		return
+	}
+
+	select {
+	case ch <- event:
+	default:
+	}
+}
+
+// Close stops the timers of the machine and closes the events
+// channel once the running fire is finished. Fire returns
+// ErrMachineClosed after the machine is closed.
+func (sm *StateMachine) Close() error {
+	sm.lockFire()
+	defer sm.unlockFire()
+
+	if sm.closed {
+		return nil
+	}
+	sm.closed = true
+
+	sm.stopTimer()
+
+	if sm.eventCh != nil {
+		close(sm.eventCh)
+	}
+
+	return nil
+}
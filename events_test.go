@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventsChannel(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+	clock := newFakeClock()
+
+	sm := NewStateMachine(Options{
+		CurrentState:       StatePending,
+		Clock:              clock,
+		EventChannelPolicy: EventChannelBlock,
+	})
+	sm.SetEvents(transferEvents(xfr))
+
+	var received []TransitionEvent
+	done := make(chan struct{})
+
+	events := sm.Events()
+	go func() {
+		defer close(done)
+		for event := range events {
+			received = append(received, event)
+		}
+	}()
+
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.NoError(t, sm.Fire("void", 50))
+	require.NoError(t, sm.Close())
+
+	<-done
+
+	require.Equal(t, []TransitionEvent{
+		{Event: "authorize", From: StatePending, To: StateAuthorized, Args: []any{100}, At: clock.Now()},
+		{Event: "void", From: StateAuthorized, To: StatePartiallyAuthorized, Args: []any{50}, At: clock.Now()},
+	}, received)
+
+	require.ErrorIs(t, sm.Fire("capture"), ErrMachineClosed)
+}
+
+func TestEventsChannelDrop(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	sm := NewStateMachine(Options{
+		CurrentState:       StatePending,
+		EventChannelBuffer: 1,
+	})
+	sm.SetEvents(transferEvents(xfr))
+
+	events := sm.Events()
+
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.NoError(t, sm.Fire("capture"))
+	require.NoError(t, sm.Close())
+
+	var received []string
+	for event := range events {
+		received = append(received, event.Event)
+	}
+
+	// capture was dropped because nobody was receiving
+	require.Equal(t, []string{"authorize"}, received)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// FieldGuard is a declarative guard comparing a field of the subject
+// with an arg, e.g. {"field": "AuthorizedAmount", "op": ">=",
+// "argIndex": 0} allows the transition when the authorized amount is at
+// least the first arg. Numbers, strings and booleans can be compared;
+// booleans only for equality.
+type FieldGuard struct {
+	Field    string `json:"field" yaml:"field"`
+	Op       string `json:"op" yaml:"op"`
+	ArgIndex int    `json:"argIndex" yaml:"argIndex"`
+}
+
+// fieldGuardOps are the supported comparison operators
+var fieldGuardOps = map[string]bool{
+	"==": true,
+	"!=": true,
+	"<":  true,
+	"<=": true,
+	">":  true,
+	">=": true,
+}
+
+// CompileFieldGuard compiles the field guard into a context guard
+// reading the field from the subject of the guard context. The field
+// and the operator are checked against the subject, a struct or a
+// pointer to it, so configuration errors are reported when the guard
+// is loaded instead of when it's evaluated. The guard rejects the
+// transition when the arg is missing or of another kind.
+func CompileFieldGuard(guard FieldGuard, subject any) (func(gc GuardContext, args ...any) bool, error) {
+	if !fieldGuardOps[guard.Op] {
+		return nil, fmt.Errorf("field guard %s: unsupported op %q", guard.Field, guard.Op)
+	}
+
+	if guard.ArgIndex < 0 {
+		return nil, fmt.Errorf("field guard %s: negative arg index %d", guard.Field, guard.ArgIndex)
+	}
+
+	typ := reflect.TypeOf(subject)
+	for typ != nil && typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("field guard %s: subject %T is not a struct", guard.Field, subject)
+	}
+
+	field, ok := typ.FieldByName(guard.Field)
+	if !ok || !field.IsExported() {
+		return nil, fmt.Errorf("field guard %s: no exported field in %s", guard.Field, typ)
+	}
+
+	kind := comparableKind(field.Type.Kind())
+	switch {
+	case kind == reflect.Invalid:
+		return nil, fmt.Errorf("field guard %s: can't compare %s", guard.Field, field.Type)
+	case kind == reflect.Bool && guard.Op != "==" && guard.Op != "!=":
+		return nil, fmt.Errorf("field guard %s: unsupported op %q for bool", guard.Field, guard.Op)
+	}
+
+	return func(gc GuardContext, args ...any) bool {
+		if guard.ArgIndex >= len(args) {
+			return false
+		}
+
+		// the machine may have no subject
+		value := reflect.ValueOf(gc.Subject())
+		if !value.IsValid() {
+			return false
+		}
+		for value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				return false
+			}
+			value = value.Elem()
+		}
+		if value.Type() != typ {
+			return false
+		}
+
+		arg := reflect.ValueOf(args[guard.ArgIndex])
+		if comparableKind(arg.Kind()) != kind {
+			return false
+		}
+
+		return compareValues(value.FieldByIndex(field.Index), arg, kind, guard.Op)
+	}, nil
+}
+
+// comparableKind groups the kinds compared by field guards: all
+// numbers are compared as floats. It returns reflect.Invalid for kinds
+// that can't be compared.
+func comparableKind(kind reflect.Kind) reflect.Kind {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return reflect.Float64
+	case reflect.String:
+		return reflect.String
+	case reflect.Bool:
+		return reflect.Bool
+	default:
+		return reflect.Invalid
+	}
+}
+
+// compareValues compares the values of the comparable kind with the op
+func compareValues(a, b reflect.Value, kind reflect.Kind, op string) bool {
+	var cmp int
+
+	switch kind {
+	case reflect.Float64:
+		x, y := toFloat(a), toFloat(b)
+		switch {
+		case x < y:
+			cmp = -1
+		case x > y:
+			cmp = 1
+		}
+	case reflect.String:
+		x, y := a.String(), b.String()
+		switch {
+		case x < y:
+			cmp = -1
+		case x > y:
+			cmp = 1
+		}
+	case reflect.Bool:
+		if a.Bool() != b.Bool() {
+			cmp = 1
+		}
+	}
+
+	switch op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+func toFloat(v reflect.Value) float64 {
+	switch {
+	case v.CanInt():
+		return float64(v.Int())
+	case v.CanUint():
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
+
+// RegisterFieldGuards decodes a JSON object mapping names to field
+// guards, compiles them against the subject and registers them as
+// context guards. Nothing is registered if any of the guards is
+// invalid.
+func (r *Registry) RegisterFieldGuards(data []byte, subject any) error {
+	var guards map[string]FieldGuard
+	if err := json.Unmarshal(data, &guards); err != nil {
+		return fmt.Errorf("decoding field guards: %w", err)
+	}
+
+	compiled := make(map[string]func(gc GuardContext, args ...any) bool, len(guards))
+	for name, guard := range guards {
+		fn, err := CompileFieldGuard(guard, subject)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		compiled[name] = fn
+	}
+
+	for name, fn := range compiled {
+		r.RegisterContextGuard(name, fn)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldGuard(t *testing.T) {
+	xfr := &Transfer{ID: "xfr", AuthorizedAmount: 100}
+
+	registry := NewRegistry()
+	err := registry.RegisterFieldGuards([]byte(`{
+		"void.partial": {"field": "AuthorizedAmount", "op": ">", "argIndex": 0}
+	}`), xfr)
+	require.NoError(t, err)
+
+	sm := NewStateMachine(Options{
+		CurrentState: StateAuthorized,
+		Subject:      xfr,
+	})
+	sm.SetEvents(map[string]Event{
+		"void": {
+			Transitions: []Transition{{
+				From:         StateAuthorized,
+				To:           StatePartiallyAuthorized,
+				ContextGuard: registry.ContextGuard("void.partial"),
+			}},
+		},
+	})
+
+	require.ErrorIs(t, sm.Fire("void", 150), ErrNoTransitionForEvent)
+	require.ErrorIs(t, sm.Fire("void", 100), ErrNoTransitionForEvent)
+	require.ErrorIs(t, sm.Fire("void", "50"), ErrNoTransitionForEvent)
+	require.ErrorIs(t, sm.Fire("void"), ErrNoTransitionForEvent)
+
+	require.NoError(t, sm.Fire("void", 50))
+	require.Equal(t, StatePartiallyAuthorized, sm.State())
+
+	t.Run("no subject", func(t *testing.T) {
+		sm := NewStateMachine(Options{
+			CurrentState: StateAuthorized,
+		})
+		sm.SetEvents(map[string]Event{
+			"void": {
+				Transitions: []Transition{{
+					From:         StateAuthorized,
+					To:           StatePartiallyAuthorized,
+					ContextGuard: registry.ContextGuard("void.partial"),
+				}},
+			},
+		})
+
+		require.ErrorIs(t, sm.Fire("void", 50), ErrNoTransitionForEvent)
+	})
+}
+
+func TestCompileFieldGuardErrors(t *testing.T) {
+	tests := map[string]struct {
+		guard FieldGuard
+		err   string
+	}{
+		"unsupported op": {
+			guard: FieldGuard{Field: "AuthorizedAmount", Op: "~="},
+			err:   `field guard AuthorizedAmount: unsupported op "~="`,
+		},
+		"missing field": {
+			guard: FieldGuard{Field: "Amount", Op: ">="},
+			err:   "field guard Amount: no exported field in main.Transfer",
+		},
+		"string field": {
+			guard: FieldGuard{Field: "Status", Op: ">"},
+			err:   "",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := CompileFieldGuard(test.guard, &Transfer{})
+			if test.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, test.err)
+		})
+	}
+
+	registry := NewRegistry()
+	err := registry.RegisterFieldGuards([]byte(`{"bad": {"field": "ID", "op": "=>"}}`), &Transfer{})
+	require.EqualError(t, err, `bad: field guard ID: unsupported op "=>"`)
+}
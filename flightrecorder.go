@@ -0,0 +1,63 @@
+package main
+
+import "time"
+
+// Timing is how long a fire took, recorded by the flight recorder
+type Timing struct {
+	Event    string
+	At       time.Time
+	Duration time.Duration
+
+	// Outcome is "ok" for committed transitions or the reason of the
+	// failure, one of the Failure constants
+	Outcome string
+}
+
+// flightRecorder keeps the timings of the last fires in a ring buffer
+type flightRecorder struct {
+	timings []Timing
+	next    int
+	full    bool
+}
+
+func newFlightRecorder(size int) *flightRecorder {
+	if size <= 0 {
+		return nil
+	}
+
+	return &flightRecorder{timings: make([]Timing, size)}
+}
+
+func (r *flightRecorder) record(timing Timing) {
+	r.timings[r.next] = timing
+	r.next = (r.next + 1) % len(r.timings)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// recent returns the recorded timings, oldest first
+func (r *flightRecorder) recent() []Timing {
+	if !r.full {
+		return append([]Timing(nil), r.timings[:r.next]...)
+	}
+
+	recent := make([]Timing, 0, len(r.timings))
+	recent = append(recent, r.timings[r.next:]...)
+	recent = append(recent, r.timings[:r.next]...)
+
+	return recent
+}
+
+// RecentTimings returns the timings of the last fires, oldest first. It
+// returns nil unless Options.FlightRecorderSize is set.
+func (sm *StateMachine) RecentTimings() []Timing {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.flightRecorder == nil {
+		return nil
+	}
+
+	return sm.flightRecorder.recent()
+}
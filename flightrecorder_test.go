@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecentTimings(t *testing.T) {
+	clock := newFakeClock()
+
+	// every On takes as many milliseconds as its arg
+	slow := func(args ...any) error {
+		clock.Advance(time.Duration(args[0].(int)) * time.Millisecond)
+		return nil
+	}
+
+	sm := NewStateMachine(Options{
+		CurrentState:       StatePending,
+		Clock:              clock,
+		FlightRecorderSize: 3,
+	})
+	sm.SetEvents(map[string]Event{
+		"authorize": {Transitions: []Transition{{From: StatePending, To: StateAuthorized, On: slow}}},
+		"review":    {Transitions: []Transition{{From: StateAuthorized, To: StateAuthorized, On: slow}}},
+		"capture": {Transitions: []Transition{{
+			From: StateAuthorized,
+			To:   StateCaptured,
+			On: func(args ...any) error {
+				clock.Advance(50 * time.Millisecond)
+				return fmt.Errorf("gateway error")
+			},
+		}}},
+	})
+
+	require.Empty(t, sm.RecentTimings())
+
+	require.NoError(t, sm.Fire("authorize", 10))
+	require.NoError(t, sm.Fire("review", 20))
+	require.NoError(t, sm.Fire("review", 30))
+	require.Error(t, sm.Fire("capture"))
+
+	start := newFakeClock().Now()
+
+	require.Equal(t, []Timing{
+		{Event: "review", At: start.Add(10 * time.Millisecond), Duration: 20 * time.Millisecond, Outcome: "ok"},
+		{Event: "review", At: start.Add(30 * time.Millisecond), Duration: 30 * time.Millisecond, Outcome: "ok"},
+		{Event: "capture", At: start.Add(60 * time.Millisecond), Duration: 50 * time.Millisecond, Outcome: FailureOnError},
+	}, sm.RecentTimings())
+}
@@ -0,0 +1,1251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrEventNotFound = fmt.Errorf("event not found")
+var ErrNoTransitionForEvent = fmt.Errorf("no transition for event")
+
+// ErrNoChange is returned by On to signal that it made no material
+// change to the subject. The transition is executed, but After is not
+// called.
+var ErrNoChange = fmt.Errorf("no change")
+
+var ErrNoHandler = fmt.Errorf("no handler for transition")
+
+var ErrTransitionBudgetExceeded = fmt.Errorf("transition budget exceeded")
+
+// Repository persists the state of the subjects driven by the state machine
+type Repository interface {
+	// LoadState returns the persisted state of the subject
+	LoadState(ctx context.Context, id string) (State, error)
+
+	// SaveState persists the new state of the subject
+	SaveState(ctx context.Context, id string, state State) error
+
+	// WithTx calls fn in a transaction, committing it if fn returns
+	// nil and rolling it back otherwise. LoadState and SaveState called
+	// with the context passed to fn must use the transaction, and
+	// LoadState must lock the subject (SELECT ... FOR UPDATE) until
+	// it's done.
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type State string
+
+type Event struct {
+	Transitions []Transition
+
+	// Auto marks the event to be fired automatically, without args,
+	// whenever the machine enters a state one of its transitions
+	// starts from
+	Auto bool
+
+	// Disabled events can't be fired
+	Disabled bool
+
+	// Feature is the name of the feature flag the event is gated
+	// behind. The event can be fired only when the feature is enabled.
+	Feature string
+
+	// Idempotent events are safe to retry: On can be called again
+	// after it failed without repeating its effect
+	Idempotent bool
+
+	// ArgsSchema declares the args of the event, see FireValidated
+	ArgsSchema ArgsSchema
+}
+
+type Transition struct {
+	From State
+	To   State
+	// Guard is a function that returns true if the transition is allowed
+	Guard func(args ...any) bool
+
+	// ContextGuard is a guard that gets the GuardContext, e.g. to read
+	// the time from the clock of the machine. If both guards are set,
+	// both must allow the transition.
+	ContextGuard func(gc GuardContext, args ...any) bool
+
+	// SoftGuard is a function that flags risky transitions without
+	// blocking them. When it returns true, the reason is recorded as a
+	// warning in the history and reported to the warning observer.
+	SoftGuard func(args ...any) (warn bool, reason string)
+
+	// On is a function that is called when the transition is triggered
+	// if the function returns an error, the transition is not executed,
+	// unless the error is ErrNoChange
+	On func(args ...any) error
+
+	// OnContext is On getting the context of the fire, e.g. to skip
+	// external effects when IsReplay reports a replay. It's called
+	// instead of On when set. It should update the subject returned by
+	// SubjectOf, so it can be run against a copy by Project.
+	OnContext func(ctx context.Context, args ...any) error
+
+	// After is a function that is called after the transition
+	After func(args ...any) error
+
+	// AfterContext is After getting the context of the fire. It's
+	// called instead of After when set. An Outbox calls it with a
+	// background context, as the fire is over by then.
+	AfterContext func(ctx context.Context, args ...any) error
+
+	// Effects are executed in order after the transition is
+	// committed and After is called. Their delivery is tracked
+	// individually, see StateMachine.Effects.
+	Effects []Effect
+
+	// Weight is the relative likelihood of the transition used by
+	// Simulate
+	Weight float64
+
+	// RateLimit limits how often the transition is taken per subject.
+	// When it's exceeded, Fire returns ErrRateLimited without calling
+	// On.
+	RateLimit *RateLimit
+}
+
+type StateMachine struct {
+	mu sync.Mutex
+
+	// firing is set while a fire runs and fired is signaled when it's
+	// finished, see lockFire
+	firing bool
+	fired  *sync.Cond
+
+	events map[string]Event
+	// eventNames are the names of the events, sorted, so iterating
+	// over the events is deterministic
+	eventNames   []string
+	currentState State
+	initialState State
+
+	resolver  StateResolver
+	subjectID string
+	cache     StateCache
+
+	clock     Clock
+	timeouts  map[State]Timeout
+	automatic automatic
+
+	featureEnabled func(feature string) bool
+	auditRedact    func(arg any) string
+
+	hierarchical   bool
+	stateSeparator string
+
+	eventCh       chan TransitionEvent
+	eventChBuffer int
+	eventChPolicy EventChannelPolicy
+	closed        bool
+
+	history   []TransitionRecord
+	histories HistoryStore
+
+	// outbox calls After when it's set, see NewOutbox
+	outbox *Outbox
+
+	onWarning func(Warning)
+
+	limiter *EventLimiter
+
+	errorHandler func(event string, err error) error
+
+	deferred       []deferredEvent
+	deferredTTL    time.Duration
+	firingDeferred bool
+
+	version int64
+
+	subject any
+
+	retry *RetryPolicy
+
+	meta    map[string]string
+	metrics Metrics
+	latency LatencyRecorder
+
+	defaultOn func(args ...any) error
+	requireOn bool
+
+	onTransition func(TransitionRecord)
+	safeMode     bool
+	onPanic      func(*PanicError)
+
+	effects []*EffectDelivery
+
+	globalGuard func(gc GuardContext, args ...any) (bool, error)
+
+	diffSubject bool
+	onDiff      func(diff SubjectDiff) error
+
+	telemetry Telemetry
+
+	buckets map[string]*tokenBucket
+
+	mustLeaveBy map[State]func(enteredAt time.Time) time.Time
+	enteredAt   time.Time
+
+	subMachines map[State]SubMachine
+
+	locker        SubjectLocker
+	lockWait      time.Duration
+	lockRetry     time.Duration
+	subjectLocked bool
+
+	// causedBy is the ID of the transition firing an automatic event
+	causedBy string
+
+	checkSubjectIntegrity bool
+
+	flightRecorder *flightRecorder
+
+	confirmBeforeAfter bool
+
+	maxTransitions int
+	transitions    int
+
+	edgeHandlers map[edge][]func(args ...any) error
+}
+
+type Options struct {
+	// or initial state
+	CurrentState State
+
+	// Repository is used to load and persist the state of the subject
+	// identified by SubjectID. If it's nil, the state is kept in memory.
+	Repository Repository
+	SubjectID  string
+
+	// StateResolver resolves and commits the current state of the
+	// subject. It takes precedence over Repository.
+	StateResolver StateResolver
+
+	// StateCache caches the state loaded from the Repository or the
+	// StateResolver. It's ignored when both are nil. A
+	// MemoryStateCache expires its entries by the Clock.
+	StateCache StateCache
+
+	// Clock is used for timers and timestamps. Defaults to the system
+	// clock.
+	Clock Clock
+
+	// Timeouts fire an event when the machine stays in a state longer
+	// than the timeout
+	Timeouts map[State]Timeout
+
+	// SubMachines nest a machine in a state: events the machine doesn't
+	// handle in the state are delegated to it, see SubMachine
+	SubMachines map[State]SubMachine
+
+	// SubjectLocker locks the subject across processes for the duration
+	// of Fire. Fire waits at most LockWait for the lock, or until the
+	// context is done if it's zero, and returns ErrLockTimeout when the
+	// wait is over. Lockers that don't implement FairSubjectLocker are
+	// retried every LockRetryInterval, 10ms by default.
+	SubjectLocker     SubjectLocker
+	LockWait          time.Duration
+	LockRetryInterval time.Duration
+
+	// CheckIntegrity makes Fire check the integrity of the subject
+	// before the guards when it implements IntegrityChecker. A failed
+	// check returns ErrSubjectCorrupt.
+	CheckIntegrity bool
+
+	// ConfirmBeforeAfter makes Fire re-read the persisted state before
+	// calling After, so After can rely on the state it was called in
+	// being the committed one. AfterContext gets the state, see
+	// ConfirmedState. If another process changed the state meanwhile,
+	// After is skipped and a warning is recorded with the transition
+	// instead.
+	ConfirmBeforeAfter bool
+
+	// MaxTransitions is the number of successful transitions after
+	// which Fire returns ErrTransitionBudgetExceeded, a safety valve
+	// against runaway loops of automatic events. Zero means unlimited.
+	MaxTransitions int
+
+	// FlightRecorderSize is the number of recent fires whose timings
+	// are kept for RecentTimings. It's disabled when zero.
+	FlightRecorderSize int
+
+	// MustLeaveBy computes the deadline by which the machine must leave
+	// the state from the time it entered it, see Overdue
+	MustLeaveBy map[State]func(enteredAt time.Time) time.Time
+
+	// FeatureEnabled reports whether the feature flag is on. Events
+	// gated behind a feature are not permitted when it's nil.
+	FeatureEnabled func(feature string) bool
+
+	// AuditRedact formats the args recorded in the audit trail. By
+	// default only the type of the arg is recorded.
+	AuditRedact func(arg any) string
+
+	// Hierarchical enables substates: transitions from a parent state
+	// are taken in its substates, e.g. a transition from authorized is
+	// taken in authorized.review
+	Hierarchical bool
+
+	// StateSeparator separates the parts of hierarchical states.
+	// Defaults to DefaultStateSeparator.
+	StateSeparator string
+
+	// EventChannelBuffer is the buffer size of the channel returned by
+	// Events and EventChannelPolicy defines what happens when it's
+	// full
+	EventChannelBuffer int
+	EventChannelPolicy EventChannelPolicy
+
+	// OnWarning is called for every warning raised by a soft guard of a
+	// successful transition
+	OnWarning func(Warning)
+
+	// EventLimiter limits the number of concurrent On calls per event.
+	// It's meant to be shared by all machines.
+	EventLimiter *EventLimiter
+
+	// ErrorHandler is called with every error returned by Fire and its
+	// return value is returned to the caller instead. It can log errors
+	// or convert internal errors into public ones. Returning nil makes
+	// Fire report success even though the transition failed, so it
+	// should be done only to deliberately swallow the error.
+	ErrorHandler func(event string, err error) error
+
+	// DeferredTTL is how long events queued by FireDeferred wait to be
+	// fired. Zero means they wait forever.
+	DeferredTTL time.Duration
+
+	// LastVersion is the last version applied by FireVersioned, e.g.
+	// restored from the subject
+	LastVersion int64
+
+	// Subject is the entity driven by the state machine, e.g. a
+	// *Transfer, see SubjectOf.
+	Subject any
+
+	// Retry retries On of idempotent events when it fails. Effectful
+	// events are never retried.
+	Retry *RetryPolicy
+
+	// Meta describes the machine, e.g. the service or the kind of the
+	// subject. It can be used as tags of the metrics.
+	Meta map[string]string
+
+	// Metrics counts completed and failed transitions and
+	// LatencyRecorder records the durations of On
+	Metrics         Metrics
+	LatencyRecorder LatencyRecorder
+
+	// DefaultOn is called instead of On for transitions without On
+	DefaultOn func(args ...any) error
+
+	// RequireOnHandler makes Fire return ErrNoHandler for transitions
+	// without On when there is no DefaultOn either. By default such
+	// transitions just change the state.
+	RequireOnHandler bool
+
+	// OnTransition is called after every successful transition
+	OnTransition func(TransitionRecord)
+
+	// HistoryStore records the transitions and the failed fires of the
+	// subject, e.g. for audits or event sourcing, see ReplayHistory
+	HistoryStore HistoryStore
+
+	// SafeMode recovers panics of guards, On, After and observers,
+	// including Metrics and Telemetry. A panic of On or After fails the
+	// fire with a *PanicError, a panicking guard rejects the transition
+	// and a panic of an observer doesn't affect the fire.
+	// Panics that can't be returned by Fire go to the ErrorHandler.
+	// All recovered panics are reported to OnPanic.
+	SafeMode bool
+	OnPanic  func(*PanicError)
+
+	// GlobalGuard is evaluated before the guards of every transition,
+	// e.g. to block all transitions of a subject under legal hold. When
+	// it returns false, Fire returns ErrGuardRejected. When it returns
+	// an error, Fire returns the error.
+	GlobalGuard func(gc GuardContext, args ...any) (bool, error)
+
+	// DiffSubject records the fields of the subject changed by every
+	// transition in the history and passes them to OnDiff. The subject
+	// must implement Cloner. OnDiff is called before the transition is
+	// committed; if it returns an error, the transition fails.
+	DiffSubject bool
+	OnDiff      func(diff SubjectDiff) error
+
+	// Telemetry is notified at every phase of a fire
+	Telemetry Telemetry
+}
+
+func NewStateMachine(opts Options) *StateMachine {
+	clock := opts.Clock
+	if clock == nil {
+		clock = realClock{}
+	}
+
+	lockRetry := opts.LockRetryInterval
+	if lockRetry == 0 {
+		lockRetry = defaultLockRetryInterval
+	}
+
+	if cache, ok := opts.StateCache.(*MemoryStateCache); ok && opts.Clock != nil {
+		cache.useClock(clock)
+	}
+
+	resolver := opts.StateResolver
+	if resolver == nil && opts.Repository != nil {
+		resolver = &RepositoryStateResolver{
+			Repository: opts.Repository,
+			SubjectID:  opts.SubjectID,
+		}
+	}
+
+	sm := &StateMachine{
+		events:       make(map[string]Event),
+		buckets:      make(map[string]*tokenBucket),
+		currentState: opts.CurrentState,
+		initialState: opts.CurrentState,
+		resolver:     resolver,
+		subjectID:    opts.SubjectID,
+		cache:        opts.StateCache,
+		clock:        clock,
+		timeouts:     opts.Timeouts,
+		mustLeaveBy:  opts.MustLeaveBy,
+		subMachines:  opts.SubMachines,
+		locker:       opts.SubjectLocker,
+		lockWait:     opts.LockWait,
+		lockRetry:    lockRetry,
+		enteredAt:    clock.Now(),
+
+		checkSubjectIntegrity: opts.CheckIntegrity,
+		flightRecorder:        newFlightRecorder(opts.FlightRecorderSize),
+		confirmBeforeAfter:    opts.ConfirmBeforeAfter,
+		maxTransitions:        opts.MaxTransitions,
+
+		featureEnabled: opts.FeatureEnabled,
+		auditRedact:    opts.AuditRedact,
+
+		hierarchical:   opts.Hierarchical,
+		stateSeparator: opts.StateSeparator,
+
+		eventChBuffer: opts.EventChannelBuffer,
+		eventChPolicy: opts.EventChannelPolicy,
+
+		onWarning: opts.OnWarning,
+		limiter:   opts.EventLimiter,
+
+		errorHandler: opts.ErrorHandler,
+		deferredTTL:  opts.DeferredTTL,
+		version:      opts.LastVersion,
+		subject:      opts.Subject,
+		retry:        opts.Retry,
+
+		meta:    opts.Meta,
+		metrics: opts.Metrics,
+		latency: opts.LatencyRecorder,
+
+		defaultOn: opts.DefaultOn,
+		requireOn: opts.RequireOnHandler,
+
+		onTransition: opts.OnTransition,
+		histories:    opts.HistoryStore,
+		safeMode:     opts.SafeMode,
+		onPanic:      opts.OnPanic,
+
+		globalGuard: opts.GlobalGuard,
+
+		diffSubject: opts.DiffSubject || opts.OnDiff != nil,
+		onDiff:      opts.OnDiff,
+
+		telemetry: opts.Telemetry,
+	}
+
+	// the machine is in the initial state from now on
+	sm.mu.Lock()
+	sm.armTimeout(sm.currentState)
+	sm.mu.Unlock()
+
+	return sm
+}
+
+// SetEvents sets the events of the machine. The automatic events of
+// the current state are fired when the events are set before the first
+// transition, as the initial state was entered without one.
+func (sm *StateMachine) SetEvents(events map[string]Event) {
+	sm.lockFire()
+	defer sm.unlockFire()
+
+	sm.events = events
+
+	sm.eventNames = make([]string, 0, len(events))
+	for name := range events {
+		sm.eventNames = append(sm.eventNames, name)
+	}
+	sort.Strings(sm.eventNames)
+
+	if !sm.automatic.started && !sm.automatic.paused {
+		sm.automatic.started = true
+		sm.fireAutomatic(context.Background(), "")
+	}
+}
+
+// Fire triggers the event and changes the state of the subject by
+// executing the transition. It executes only the first transition.
+// After, the observers, the edge handlers and the effects are called
+// without holding the lock, so they can read the machine, e.g. call
+// State, but they must not fire its events.
+func (sm *StateMachine) Fire(name string, args ...any) error {
+	return sm.FireContext(context.Background(), name, args...)
+}
+
+// FireContext fires the event like Fire. The context is passed to
+// OnContext, AfterContext and, via GuardContext.Context, to context
+// guards. It bounds the time spent waiting for the locks and the
+// concurrency limit of the event, and a transition whose context is
+// done before the new state is saved is aborted with the error of the
+// context.
+func (sm *StateMachine) FireContext(ctx context.Context, name string, args ...any) error {
+	sm.lockFire()
+	defer sm.unlockFire()
+
+	return sm.handleError(name, sm.fire(ctx, name, args...))
+}
+
+// FireCtx is FireContext.
+//
+// Deprecated: use FireContext.
+func (sm *StateMachine) FireCtx(ctx context.Context, name string, args ...any) error {
+	return sm.FireContext(ctx, name, args...)
+}
+
+// lockFire acquires the lock and waits until the running fire, if any,
+// is finished, as its callbacks may run without the lock, see
+// unlocked. Public methods firing events or calling the callbacks of
+// the transitions lock the machine with it.
+func (sm *StateMachine) lockFire() {
+	sm.mu.Lock()
+
+	if sm.fired == nil {
+		sm.fired = sync.NewCond(&sm.mu)
+	}
+	for sm.firing {
+		sm.fired.Wait()
+	}
+	sm.firing = true
+}
+
+// unlockFire finishes the fire and releases the lock
+func (sm *StateMachine) unlockFire() {
+	sm.firing = false
+	sm.fired.Broadcast()
+
+	sm.mu.Unlock()
+}
+
+// unlocked calls the callback of a committed transition, e.g. After or
+// an observer, without holding the lock, so it can read the machine.
+// Other fires keep waiting for the running one. Outside of a fire the
+// lock is kept. The caller must hold the lock.
+func (sm *StateMachine) unlocked(fn func()) {
+	if !sm.firing {
+		fn()
+		return
+	}
+
+	sm.mu.Unlock()
+	defer sm.mu.Lock()
+
+	fn()
+}
+
+// handleError passes the error returned by a fire to the error handler
+// and returns what the handler returns
+func (sm *StateMachine) handleError(event string, err error) error {
+	if err == nil || sm.errorHandler == nil {
+		return err
+	}
+
+	return sm.errorHandler(event, err)
+}
+
+// fire executes the event. The caller must hold the lock.
+func (sm *StateMachine) fire(ctx context.Context, name string, args ...any) error {
+	return sm.fireTraced(ctx, nil, name, args...)
+}
+
+// Meta returns the meta of the machine
+func (sm *StateMachine) Meta() map[string]string {
+	return sm.meta
+}
+
+// fireTrace records what happened while firing an event
+type fireTrace struct {
+	// audit makes gate evaluate and record all guards
+	audit bool
+
+	from       State
+	guards     []guardEvaluation
+	transition *Transition
+	warnings   []string
+	onErr      error
+
+	// started is set once the current state is loaded, rejected when
+	// no transition can be taken and committed once the new state is
+	// persisted
+	started   bool
+	rejected  bool
+	committed bool
+
+	// batch is the ID of the batch of the fire
+	batch string
+
+	// failure is the reason of the failure when it can't be derived
+	// from the error
+	failure string
+
+	// staged is set when the transition is begun by Begin against a
+	// copy of the subject
+	staged bool
+}
+
+type guardEvaluation struct {
+	transition Transition
+	allowed    bool
+}
+
+// fireTraced executes the event and records the outcome into the trace
+// if it's not nil. The caller must hold the lock.
+func (sm *StateMachine) fireTraced(ctx context.Context, trace *fireTrace, name string, args ...any) error {
+	if trace == nil {
+		trace = &fireTrace{}
+	}
+
+	return sm.traced(ctx, trace, name, args, func() error {
+		return sm.execute(ctx, trace, name, args...)
+	})
+}
+
+// traced runs the fire of the event holding the subject lock and
+// reports its outcome to the flight recorder, the metrics, the history
+// and the telemetry. The caller must hold the lock.
+func (sm *StateMachine) traced(ctx context.Context, trace *fireTrace, name string, args []any, run func() error) error {
+	trace.batch = BatchID(ctx)
+
+	started := sm.clock.Now()
+
+	var err error
+
+	// the subject lock is held by the outermost fire, so the fires it
+	// triggers, e.g. of automatic events, don't wait for it
+	if sm.locker != nil && !sm.subjectLocked {
+		var unlock func()
+		unlock, err = sm.lockSubject(ctx)
+		if err == nil {
+			sm.subjectLocked = true
+			err = run()
+			sm.subjectLocked = false
+			unlock()
+		} else if !errors.Is(err, ErrLockTimeout) {
+			trace.failure = FailureLock
+		}
+	} else {
+		err = run()
+	}
+
+	if sm.flightRecorder != nil {
+		outcome := "ok"
+		if err != nil {
+			outcome = failureReason(trace, err)
+		}
+
+		sm.flightRecorder.record(Timing{
+			Event:    name,
+			At:       started,
+			Duration: sm.clock.Now().Sub(started),
+			Outcome:  outcome,
+		})
+	}
+
+	// a replay only rebuilds what was already reported
+	replay := IsReplay(ctx)
+
+	if err != nil && sm.metrics != nil && !replay {
+		reason := failureReason(trace, err)
+		sm.unlocked(func() {
+			sm.notify(name, "Metrics", func() {
+				sm.metrics.TransitionFailed(name, reason)
+			})
+		})
+	}
+
+	if err != nil && !trace.committed {
+		sm.recordFailure(ctx, trace, name, args, err)
+	}
+
+	if err != nil && sm.telemetry != nil && !replay {
+		result := trace.result(name, args, err)
+
+		sm.unlocked(func() {
+			sm.notify(name, "Telemetry", func() {
+				switch {
+				case trace.rejected:
+					sm.telemetry.TransitionRejected(result)
+				case trace.started && !trace.committed:
+					sm.telemetry.TransitionFailed(result)
+				}
+			})
+		})
+	}
+
+	return err
+}
+
+// admit returns an error if the machine can't fire the event. The
+// caller must hold the lock.
+func (sm *StateMachine) admit(ctx context.Context, name string) error {
+	if sm.closed {
+		return ErrMachineClosed
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("event %s: %w", name, err)
+	}
+
+	if sm.maxTransitions > 0 && sm.transitions >= sm.maxTransitions && !IsReplay(ctx) {
+		return fmt.Errorf("event %s: %d transitions made: %w", name, sm.transitions, ErrTransitionBudgetExceeded)
+	}
+
+	return nil
+}
+
+// execute executes the event. The caller must hold the lock.
+func (sm *StateMachine) execute(ctx context.Context, trace *fireTrace, name string, args ...any) error {
+	if err := sm.admit(ctx, name); err != nil {
+		return err
+	}
+
+	// the current state is loaded and locked (SELECT ... FOR UPDATE),
+	// the transition is checked, On is called and the new state is
+	// saved in one transaction. After is called once it's committed.
+	var pending *pendingTransition
+
+	ctx = withSubject(ctx, sm.subject)
+
+	err := sm.withTx(ctx, func(ctx context.Context) error {
+		prepared, err := sm.prepare(ctx, trace, name, args)
+		if err != nil {
+			return err
+		}
+
+		if prepared.sub == nil {
+			if err := sm.save(ctx, trace, prepared); err != nil {
+				return err
+			}
+		}
+
+		pending = prepared
+		return nil
+	})
+	if err != nil {
+		if pending != nil {
+			return sm.rollback(ctx, trace, pending, err)
+		}
+		return err
+	}
+
+	if pending.sub != nil {
+		return sm.delegate(ctx, pending.from, *pending.sub, name, args)
+	}
+
+	sm.cacheState(pending.transition.To)
+
+	return sm.commit(ctx, trace, pending)
+}
+
+// pendingTransition is a transition executed in the transaction of the
+// fire that is not committed yet
+type pendingTransition struct {
+	name       string
+	args       []any
+	from       State
+	transition Transition
+	causedBy   string
+	changed    bool
+	warnings   []string
+	diff       SubjectDiff
+
+	// entry is the outbox entry added for After in the transaction
+	entry *OutboxEntry
+
+	// sub is set when the event is delegated to the sub-machine of the
+	// current state instead
+	sub *SubMachine
+}
+
+// rollback reverts the saved transition whose transaction failed to
+// commit. The caller must hold the lock.
+func (sm *StateMachine) rollback(ctx context.Context, trace *fireTrace, pending *pendingTransition, err error) error {
+	sm.currentState = pending.from
+	if sm.cache != nil {
+		sm.cache.Invalidate(sm.subjectID)
+	}
+	sm.unstageAfter(ctx, pending)
+	trace.failure = FailurePersistence
+
+	return fmt.Errorf("committing transition from %s to %s: %w", pending.from, pending.transition.To, err)
+}
+
+// prepare selects the transition and executes it up to saving the new
+// state, updating the subject returned by SubjectOf. On failure the
+// state is reverted. The caller must hold the lock.
+func (sm *StateMachine) prepare(ctx context.Context, trace *fireTrace, name string, args []any) (*pendingTransition, error) {
+	current, err := sm.lockState(ctx)
+	if err != nil {
+		trace.failure = FailurePersistence
+		return nil, fmt.Errorf("loading state: %w", err)
+	}
+
+	trace.from = current
+
+	// only the fire of the automatic event is caused by the transition,
+	// not the fires it triggers
+	causedBy := sm.causedBy
+	sm.causedBy = ""
+
+	subject := SubjectOf(ctx)
+
+	if err := sm.checkIntegrity(name, subject); err != nil {
+		trace.failure = FailureCorrupt
+		return nil, err
+	}
+
+	if sub, ok := sm.subMachines[current]; ok && !sm.handles(name, current) {
+		return &pendingTransition{from: current, sub: &sub}, nil
+	}
+
+	trace.started = true
+
+	if sm.telemetry != nil && !IsReplay(ctx) {
+		sm.notify(name, "Telemetry", func() {
+			sm.telemetry.TransitionStarted(trace.result(name, args, nil))
+		})
+	}
+
+	event, ok := sm.events[name]
+	if !ok {
+		trace.rejected = true
+		return nil, ErrEventNotFound
+	}
+
+	gc := sm.guardContext(ctx, name, current)
+	gc.subject = subject
+
+	transition, rejected := sm.gate(gc, event, args, trace)
+	if rejected != nil {
+		trace.rejected = true
+		// the event can't be fired from this state at all, which is
+		// not the same failure as a guard blocking it
+		if rejected.reason == reasonNoMatchingFrom {
+			trace.failure = FailureInvalidState
+		}
+		return nil, gateError(name, rejected)
+	}
+
+	trace.transition = &transition
+
+	currentState := current
+
+	// On would change the subject, not its staged copy
+	if trace.staged && transition.On != nil && transition.OnContext == nil {
+		return nil, fmt.Errorf("event %s from %s to %s: %w", name, currentState, transition.To, ErrNotStageable)
+	}
+
+	if transition.OnContext != nil {
+		onContext := transition.OnContext
+		transition.On = func(args ...any) error {
+			return onContext(ctx, args...)
+		}
+	}
+
+	if transition.AfterContext != nil {
+		afterContext := transition.AfterContext
+		transition.After = func(args ...any) error {
+			return afterContext(ctx, args...)
+		}
+	}
+
+	if transition.On == nil {
+		if sm.defaultOn != nil {
+			transition.On = sm.defaultOn
+		} else if sm.requireOn {
+			return nil, fmt.Errorf("event %s from %s to %s: %w", name, currentState, transition.To, ErrNoHandler)
+		}
+	}
+
+	if !IsReplay(ctx) {
+		if err := sm.allowRate(name, transition); err != nil {
+			return nil, err
+		}
+	}
+
+	warnings := sm.softGuardWarnings(name, transition, args)
+	trace.warnings = warnings
+
+	sm.currentState = transition.To
+
+	before := sm.snapshot(subject)
+
+	changed := true
+
+	if transition.On != nil {
+		var limitErr error
+
+		err := func() error {
+			if sm.limiter != nil {
+				if limitErr = sm.limiter.Acquire(ctx, name); limitErr != nil {
+					return limitErr
+				}
+				// released even if On panics outside of safe mode
+				defer sm.limiter.Release(name)
+			}
+
+			started := sm.clock.Now()
+			err := sm.protect(name, "On", func() error {
+				return sm.callOn(event, transition, args)
+			})
+			if sm.latency != nil {
+				sm.latency.ObserveOnDuration(name, sm.clock.Now().Sub(started))
+			}
+
+			return err
+		}()
+
+		if limitErr != nil {
+			sm.currentState = currentState
+			return nil, fmt.Errorf("event %s: waiting for concurrency limit: %w", name, limitErr)
+		}
+
+		if errors.Is(err, ErrNoChange) {
+			changed = false
+		} else if err != nil {
+			sm.currentState = currentState
+			trace.onErr = err
+			return nil, fmt.Errorf("error during transition from %s to %s: %w", currentState, transition.To, err)
+		}
+	}
+
+	var diff SubjectDiff
+	if before != nil {
+		var err error
+		diff, err = diffSubjects(before, subject)
+		if err != nil {
+			sm.currentState = currentState
+			return nil, fmt.Errorf("diffing subject: %w", err)
+		}
+
+		if sm.onDiff != nil {
+			err = sm.protect(name, "OnDiff", func() error {
+				return sm.onDiff(diff)
+			})
+			if err != nil {
+				sm.currentState = currentState
+				return nil, fmt.Errorf("error during transition from %s to %s: %w", currentState, transition.To, err)
+			}
+		}
+	}
+
+	warnings = append(warnings, sm.balanceWarnings(name, subject)...)
+	trace.warnings = warnings
+
+	// On may have taken until the deadline, e.g. calling the gateway
+	if err := ctx.Err(); err != nil {
+		sm.currentState = currentState
+		return nil, fmt.Errorf("event %s: aborted before saving state %s: %w", name, transition.To, err)
+	}
+
+	return &pendingTransition{
+		name:       name,
+		args:       args,
+		from:       currentState,
+		transition: transition,
+		causedBy:   causedBy,
+		changed:    changed,
+		warnings:   warnings,
+		diff:       diff,
+	}, nil
+}
+
+// save saves the new state of the prepared transition and adds its
+// outbox entry. On failure the state is reverted. The caller must hold
+// the lock.
+func (sm *StateMachine) save(ctx context.Context, trace *fireTrace, pending *pendingTransition) error {
+	if err := sm.saveState(ctx, pending.from, pending.transition.To); err != nil {
+		trace.failure = FailurePersistence
+		sm.currentState = pending.from
+		return fmt.Errorf("saving state %s: %w", pending.transition.To, err)
+	}
+
+	if err := sm.stageAfter(ctx, pending); err != nil {
+		trace.failure = FailurePersistence
+		sm.currentState = pending.from
+		return err
+	}
+
+	return nil
+}
+
+// commit records the committed transition, notifies the observers and
+// calls After. The caller must hold the lock.
+func (sm *StateMachine) commit(ctx context.Context, trace *fireTrace, pending *pendingTransition) error {
+	name, args := pending.name, pending.args
+	currentState, transition := pending.from, pending.transition
+
+	// After of a transition with an outbox entry is called by the
+	// outbox, so its failure doesn't fail the fire
+	if pending.entry != nil {
+		transition.After = nil
+		transition.AfterContext = nil
+	}
+
+	// the effects of a replayed transition already happened
+	callAfter := !IsReplay(ctx) && pending.changed &&
+		(transition.After != nil || sm.hasEdgeHandlers(currentState, transition.To))
+
+	// the state is confirmed before the transition is recorded, so the
+	// warning is part of the record
+	afterCtx := ctx
+	if callAfter {
+		var reason string
+		afterCtx, reason = sm.confirmState(ctx, transition.To)
+		if reason != "" {
+			pending.warnings = append(pending.warnings, reason)
+			trace.warnings = pending.warnings
+			callAfter = false
+		}
+	}
+
+	record := TransitionRecord{
+		ID:       fmt.Sprintf("%s/%s", sm.subjectID, randomID()),
+		CausedBy: pending.causedBy,
+		BatchID:  trace.batch,
+		Event:    name,
+		From:     currentState,
+		To:       transition.To,
+		Args:     args,
+		At:       sm.clock.Now(),
+		Warnings: pending.warnings,
+		Diff:     pending.diff,
+	}
+
+	// a replayed transition keeps its identity and was already
+	// reported, and it doesn't count against MaxTransitions
+	if original := replayed(ctx); original != nil {
+		record.ID = original.ID
+		record.CausedBy = original.CausedBy
+
+		sm.history = append(sm.history, record)
+		sm.enteredAt = record.At
+		trace.committed = true
+
+		return nil
+	}
+
+	sm.history = append(sm.history, record)
+	sm.enteredAt = record.At
+	sm.transitions++
+
+	sm.recordTransition(ctx, record)
+
+	trace.committed = true
+
+	if sm.telemetry != nil {
+		result := trace.result(name, args, nil)
+		sm.unlocked(func() {
+			sm.notify(name, "Telemetry", func() {
+				sm.telemetry.TransitionCommitted(result)
+			})
+		})
+	}
+
+	if sm.onTransition != nil {
+		sm.unlocked(func() {
+			sm.notify(name, "OnTransition", func() {
+				sm.onTransition(record)
+			})
+		})
+	}
+
+	sm.warn(name, currentState, transition.To, pending.warnings)
+
+	if sm.metrics != nil {
+		sm.unlocked(func() {
+			sm.notify(name, "Metrics", func() {
+				sm.metrics.TransitionCompleted(name, string(currentState), string(transition.To))
+
+				if batched, ok := sm.metrics.(BatchMetrics); ok && trace.batch != "" {
+					batched.BatchTransitionCompleted(trace.batch, name, string(currentState), string(transition.To))
+				}
+			})
+		})
+	}
+
+	sm.emit(TransitionEvent{
+		Event: name,
+		From:  currentState,
+		To:    transition.To,
+		Args:  args,
+		At:    record.At,
+	})
+
+	if pending.entry != nil {
+		sm.outbox.push(*pending.entry)
+	}
+
+	var afterErr error
+	if callAfter {
+		if transition.After != nil {
+			after := transition.After
+			if afterContext := transition.AfterContext; afterContext != nil {
+				after = func(args ...any) error {
+					return afterContext(afterCtx, args...)
+				}
+			}
+
+			var err error
+			sm.unlocked(func() {
+				err = sm.protect(name, "After", func() error {
+					return after(args...)
+				})
+			})
+			if err != nil {
+				afterErr = fmt.Errorf("error calling after function: %w", err)
+			}
+		}
+
+		if err := sm.callEdgeHandlers(name, currentState, transition.To, args); err != nil && afterErr == nil {
+			afterErr = err
+		}
+	}
+
+	sm.runEffects(record.ID, name, transition, args)
+
+	// the transition is committed even if After failed
+	sm.entered(ctx, transition.To, record.ID)
+
+	return afterErr
+}
+
+// State returns the current state of the subject. When the state can't
+// be resolved, the last known state is returned.
+func (sm *StateMachine) State() State {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	state, err := sm.loadState(context.Background())
+	if err != nil {
+		return sm.currentState
+	}
+
+	return state
+}
+
+// InState returns true if the current state is any of the states. In
+// hierarchical machines substates are in their parent states. The state
+// is read once under the lock, so unlike comparing the result of
+// several State calls, it can't change between the comparisons.
+func (sm *StateMachine) InState(states ...State) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	current, err := sm.loadState(context.Background())
+	if err != nil {
+		current = sm.currentState
+	}
+
+	for _, state := range states {
+		if sm.matchesFrom(current, state) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loadState returns the current state of the subject, served from the
+// cache when possible
+func (sm *StateMachine) loadState(ctx context.Context) (State, error) {
+	if sm.resolver == nil {
+		return sm.currentState, nil
+	}
+
+	if sm.cache != nil {
+		if state, ok := sm.cache.Get(sm.subjectID); ok {
+			return state, nil
+		}
+	}
+
+	state, err := sm.resolver.Current(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	sm.currentState = state
+
+	if sm.cache != nil {
+		sm.cache.Set(sm.subjectID, state)
+	}
+
+	return state, nil
+}
+
+// lockState loads the current state of the subject for a fire from
+// the resolver, bypassing the cache, so a transactional resolver locks
+// it (SELECT ... FOR UPDATE) until the transaction is over. The cache
+// is refreshed by cacheState once the transaction is committed.
+func (sm *StateMachine) lockState(ctx context.Context) (State, error) {
+	if sm.resolver == nil {
+		return sm.currentState, nil
+	}
+
+	state, err := sm.resolver.Current(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	sm.currentState = state
+
+	return state, nil
+}
+
+// saveState commits the transition of the subject to the new state. If
+// committing fails, the cached state is invalidated.
+func (sm *StateMachine) saveState(ctx context.Context, from, state State) error {
+	if sm.resolver == nil {
+		return nil
+	}
+
+	err := sm.resolver.Commit(ctx, from, state)
+	if err != nil {
+		if sm.cache != nil {
+			sm.cache.Invalidate(sm.subjectID)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// cacheState caches the state of the subject after the transaction
+// saving it is committed
+func (sm *StateMachine) cacheState(state State) {
+	if sm.resolver != nil && sm.cache != nil {
+		sm.cache.Set(sm.subjectID, state)
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnNoChangeSkipsAfter(t *testing.T) {
+	var afterCalled bool
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(map[string]Event{
+		"authorize": {
+			Transitions: []Transition{
+				{
+					From: StatePending,
+					To:   StateAuthorized,
+					On: func(args ...any) error {
+						return ErrNoChange
+					},
+					After: func(args ...any) error {
+						afterCalled = true
+						return nil
+					},
+				},
+			},
+		},
+	})
+
+	err := sm.Fire("authorize")
+	require.NoError(t, err)
+	require.Equal(t, StateAuthorized, sm.State())
+	require.False(t, afterCalled)
+}
+
+func TestErrorHandler(t *testing.T) {
+	errPublic := fmt.Errorf("transfer can't be authorized")
+
+	var handled []string
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		ErrorHandler: func(event string, err error) error {
+			handled = append(handled, fmt.Sprintf("%s: %s", event, err))
+
+			return errPublic
+		},
+	})
+	sm.SetEvents(map[string]Event{
+		"authorize": {
+			Transitions: []Transition{
+				{
+					From: StatePending,
+					To:   StateAuthorized,
+					On: func(args ...any) error {
+						return fmt.Errorf("gateway: connection reset by 10.0.0.1")
+					},
+				},
+			},
+		},
+	})
+
+	err := sm.Fire("authorize")
+	require.Same(t, errPublic, err)
+	require.Equal(t, []string{
+		"authorize: error during transition from pending to authorized: gateway: connection reset by 10.0.0.1",
+	}, handled)
+	require.Equal(t, StatePending, sm.State())
+
+	// successful fires don't call the handler
+	handled = nil
+	sm.SetEvents(transferEvents(&Transfer{}))
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.Empty(t, handled)
+}
+
+func TestRequireOnHandler(t *testing.T) {
+	for _, required := range []bool{false, true} {
+		t.Run(fmt.Sprintf("required=%v", required), func(t *testing.T) {
+			sm := NewStateMachine(Options{
+				CurrentState:     StatePending,
+				RequireOnHandler: required,
+			})
+			sm.SetEvents(transferEvents(&Transfer{}))
+
+			require.NoError(t, sm.Fire("authorize", 100))
+
+			err := sm.Fire("capture")
+			if !required {
+				require.NoError(t, err)
+				require.Equal(t, StateCaptured, sm.State())
+				return
+			}
+
+			require.ErrorIs(t, err, ErrNoHandler)
+			require.EqualError(t, err, "event capture from authorized to captured: no handler for transition")
+			require.Equal(t, StateAuthorized, sm.State())
+		})
+	}
+}
+
+func TestDefaultOn(t *testing.T) {
+	var called []any
+
+	sm := NewStateMachine(Options{
+		CurrentState:     StateAuthorized,
+		RequireOnHandler: true,
+		DefaultOn: func(args ...any) error {
+			called = args
+			return nil
+		},
+	})
+	sm.SetEvents(transferEvents(&Transfer{}))
+
+	require.NoError(t, sm.Fire("capture", "ref"))
+	require.Equal(t, []any{"ref"}, called)
+	require.Equal(t, StateCaptured, sm.State())
+}
+
+func TestInState(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(transferEvents(xfr))
+
+	require.False(t, sm.InState(StateAuthorized, StatePartiallyAuthorized))
+
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.NoError(t, sm.Fire("void", 50))
+
+	require.True(t, sm.InState(StateAuthorized, StatePartiallyAuthorized))
+	require.False(t, sm.InState(StateCaptured, StateVoided))
+	require.False(t, sm.InState())
+}
+
+func TestFireTransactional(t *testing.T) {
+	repo := newFakeRepository(map[string]State{"xfr": StatePending})
+
+	var afterState State
+
+	events := transferEvents(&Transfer{})
+	authorize := events["authorize"].Transitions[0]
+	authorize.After = func(args ...any) error {
+		afterState = repo.committed("xfr")
+		return nil
+	}
+	events["authorize"] = Event{Transitions: []Transition{authorize}}
+
+	sm := NewStateMachine(Options{
+		Repository: repo,
+		SubjectID:  "xfr",
+	})
+	sm.SetEvents(events)
+
+	// the commit fails, so the state is reverted and After isn't called
+	repo.commitErr = fmt.Errorf("serialization failure")
+
+	err := sm.Fire("authorize", 100)
+	require.EqualError(t, err, "committing transition from pending to authorized: serialization failure")
+	require.Equal(t, StatePending, sm.State())
+	require.Equal(t, StatePending, repo.committed("xfr"))
+	require.Empty(t, afterState)
+	require.Empty(t, sm.History())
+
+	// saving the state fails, so the transaction is rolled back
+	repo.commitErr = nil
+	repo.saveErr = fmt.Errorf("connection lost")
+
+	err = sm.Fire("authorize", 100)
+	require.EqualError(t, err, "saving state authorized: connection lost")
+	require.Equal(t, StatePending, sm.State())
+	require.Equal(t, 2, repo.rollbacks)
+
+	// After is called once the transaction is committed
+	repo.saveErr = nil
+
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.Equal(t, StateAuthorized, sm.State())
+	require.Equal(t, StateAuthorized, afterState)
+	require.Equal(t, 1, repo.commits)
+}
+
+func TestMaxTransitions(t *testing.T) {
+	events := transferEvents(&Transfer{})
+	events["review"] = Event{
+		Transitions: []Transition{{From: StateAuthorized, To: StateAuthorized}},
+	}
+
+	sm := NewStateMachine(Options{
+		CurrentState:   StatePending,
+		MaxTransitions: 2,
+	})
+	sm.SetEvents(events)
+
+	// rejected fires don't count
+	require.ErrorIs(t, sm.Fire("capture"), ErrNoTransitionForEvent)
+
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.NoError(t, sm.Fire("review"))
+
+	err := sm.Fire("review")
+	require.ErrorIs(t, err, ErrTransitionBudgetExceeded)
+	require.EqualError(t, err, "event review: 2 transitions made: transition budget exceeded")
+	require.Len(t, sm.History(), 2)
+}
+
+func TestFireContextCancellation(t *testing.T) {
+	type requestKey struct{}
+
+	ctx := context.WithValue(context.Background(), requestKey{}, "req-1")
+
+	var seen []any
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(map[string]Event{
+		"authorize": {
+			Transitions: []Transition{{
+				From: StatePending,
+				To:   StateAuthorized,
+				ContextGuard: func(gc GuardContext, args ...any) bool {
+					seen = append(seen, gc.Context().Value(requestKey{}))
+					return true
+				},
+				OnContext: func(ctx context.Context, args ...any) error {
+					seen = append(seen, ctx.Value(requestKey{}))
+					return nil
+				},
+				AfterContext: func(ctx context.Context, args ...any) error {
+					seen = append(seen, ctx.Value(requestKey{}))
+					return nil
+				},
+			}},
+		},
+		"capture": {
+			Transitions: []Transition{{
+				From: StateAuthorized,
+				To:   StateCaptured,
+				OnContext: func(ctx context.Context, args ...any) error {
+					// the gateway call outlives the deadline
+					<-ctx.Done()
+					return nil
+				},
+			}},
+		},
+	})
+
+	require.NoError(t, sm.FireContext(ctx, "authorize"))
+	require.Equal(t, []any{"req-1", "req-1", "req-1"}, seen)
+
+	t.Run("deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := sm.FireContext(ctx, "capture")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, StateAuthorized, sm.State())
+		require.Len(t, sm.History(), 1)
+
+		// canceled before the fire
+		err = sm.FireContext(ctx, "capture")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestCallbacksReadMachine(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	var seen []State
+	var recorded int
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+
+	events := transferEvents(xfr)
+	authorize := events["authorize"].Transitions[0]
+	authorize.After = func(args ...any) error {
+		seen = append(seen, sm.State())
+		recorded = len(sm.History())
+		return nil
+	}
+	events["authorize"] = Event{Transitions: []Transition{authorize}}
+	sm.SetEvents(events)
+
+	sm.OnEdge(StatePending, StateAuthorized, func(args ...any) error {
+		seen = append(seen, sm.State())
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sm.Fire("authorize", 100)
+	}()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("fire deadlocked")
+	}
+
+	require.Equal(t, []State{StateAuthorized, StateAuthorized}, seen)
+	require.Equal(t, 1, recorded)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+)
+
+// handlerName is the name under which the function field of the
+// transition is referenced in generated code, e.g.
+// void.authorized.voided.Guard
+func handlerName(event string, transition Transition, field string) string {
+	return fmt.Sprintf("%s.%s.%s.%s", event, transition.From, transition.To, field)
+}
+
+// ToGoSource generates Go source declaring the events of the machine
+// as a map[string]Event variable named varName. Functions can't be
+// generated, so guards and actions are emitted as references to a
+// Registry declared next to the variable as <varName>Registry. The
+// functions must be registered under the names returned by
+// handlerName, e.g. void.authorized.voided.Guard. As for ExportBundle,
+// OnContext, AfterContext and Effects can't be referenced, so a machine
+// using them is not generated.
+func (sm *StateMachine) ToGoSource(pkg, varName string) (string, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	registry := varName + "Registry"
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "// Code generated by ToGoSource. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	fmt.Fprintf(&buf, "var %s = NewRegistry()\n\n", registry)
+	fmt.Fprintf(&buf, "var %s = map[string]Event{\n", varName)
+
+	for _, name := range sm.eventNames {
+		event := sm.events[name]
+
+		if err := exportable(name, event); err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(&buf, "%q: {\n", name)
+		if event.Auto {
+			fmt.Fprintf(&buf, "Auto: true,\n")
+		}
+		if event.Disabled {
+			fmt.Fprintf(&buf, "Disabled: true,\n")
+		}
+		if event.Feature != "" {
+			fmt.Fprintf(&buf, "Feature: %q,\n", event.Feature)
+		}
+		if event.Idempotent {
+			fmt.Fprintf(&buf, "Idempotent: true,\n")
+		}
+		if event.ArgsSchema != nil {
+			fmt.Fprintf(&buf, "ArgsSchema: ArgsSchema{\n")
+			for _, field := range event.ArgsSchema {
+				fmt.Fprintf(&buf, "{Name: %q, Type: %q, Required: %t},\n", field.Name, field.Type, field.Required)
+			}
+			fmt.Fprintf(&buf, "},\n")
+		}
+
+		fmt.Fprintf(&buf, "Transitions: []Transition{\n")
+		for _, transition := range event.Transitions {
+			fmt.Fprintf(&buf, "{\n")
+			fmt.Fprintf(&buf, "From: %q,\n", transition.From)
+			fmt.Fprintf(&buf, "To: %q,\n", transition.To)
+			if transition.Guard != nil {
+				fmt.Fprintf(&buf, "Guard: %s.Guard(%q),\n", registry, handlerName(name, transition, "Guard"))
+			}
+			if transition.ContextGuard != nil {
+				fmt.Fprintf(&buf, "ContextGuard: %s.ContextGuard(%q),\n", registry, handlerName(name, transition, "ContextGuard"))
+			}
+			if transition.SoftGuard != nil {
+				fmt.Fprintf(&buf, "SoftGuard: %s.SoftGuard(%q),\n", registry, handlerName(name, transition, "SoftGuard"))
+			}
+			if transition.On != nil {
+				fmt.Fprintf(&buf, "On: %s.Action(%q),\n", registry, handlerName(name, transition, "On"))
+			}
+			if transition.After != nil {
+				fmt.Fprintf(&buf, "After: %s.Action(%q),\n", registry, handlerName(name, transition, "After"))
+			}
+			if transition.Weight != 0 {
+				fmt.Fprintf(&buf, "Weight: %v,\n", transition.Weight)
+			}
+			if rateLimit := transition.RateLimit; rateLimit != nil {
+				fmt.Fprintf(&buf, "RateLimit: &RateLimit{Rate: %v, Burst: %d},\n", rateLimit.Rate, rateLimit.Burst)
+			}
+			fmt.Fprintf(&buf, "},\n")
+		}
+		fmt.Fprintf(&buf, "},\n")
+		fmt.Fprintf(&buf, "},\n")
+	}
+
+	fmt.Fprintf(&buf, "}\n")
+
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("formatting generated source: %w", err)
+	}
+
+	return string(source), nil
+}
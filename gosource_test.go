@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToGoSource(t *testing.T) {
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(map[string]Event{
+		"authorize": {
+			ArgsSchema: ArgsSchema{{Name: "amount", Type: "int", Required: true}},
+			Transitions: []Transition{
+				{
+					From: StatePending,
+					To:   StateAuthorized,
+					On:   func(args ...any) error { return nil },
+				},
+			},
+		},
+		"capture": {
+			Auto: true,
+			Transitions: []Transition{
+				{
+					From:      StateAuthorized,
+					To:        StateCaptured,
+					Guard:     func(args ...any) bool { return true },
+					RateLimit: &RateLimit{Rate: 0.5, Burst: 2},
+				},
+			},
+		},
+	})
+
+	source, err := sm.ToGoSource("transfers", "transferEvents")
+	require.NoError(t, err)
+
+	require.Equal(t, `// Code generated by ToGoSource. DO NOT EDIT.
+
+package transfers
+
+var transferEventsRegistry = NewRegistry()
+
+var transferEvents = map[string]Event{
+	"authorize": {
+		ArgsSchema: ArgsSchema{
+			{Name: "amount", Type: "int", Required: true},
+		},
+		Transitions: []Transition{
+			{
+				From: "pending",
+				To:   "authorized",
+				On:   transferEventsRegistry.Action("authorize.pending.authorized.On"),
+			},
+		},
+	},
+	"capture": {
+		Auto: true,
+		Transitions: []Transition{
+			{
+				From:      "authorized",
+				To:        "captured",
+				Guard:     transferEventsRegistry.Guard("capture.authorized.captured.Guard"),
+				RateLimit: &RateLimit{Rate: 0.5, Burst: 2},
+			},
+		},
+	},
+}
+`, source)
+}
+
+func TestToGoSourceUnexportable(t *testing.T) {
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(map[string]Event{
+		"authorize": {
+			Transitions: []Transition{{
+				From:    StatePending,
+				To:      StateAuthorized,
+				Effects: []Effect{{Name: "notify", Run: func(key string, args ...any) error { return nil }}},
+			}},
+		},
+	})
+
+	_, err := sm.ToGoSource("transfers", "transferEvents")
+	require.EqualError(t, err, "event authorize from pending to authorized: Effects can't be exported")
+}
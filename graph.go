@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"sort"
+)
+
+// graphEdge is a transition of the machine seen as an edge of a
+// directed graph of states
+type graphEdge struct {
+	event string
+	to    State
+}
+
+// graph returns the outgoing edges of every state, ignoring guards.
+// Edges are ordered by event name and then by transition order. The
+// caller must hold the lock.
+func (sm *StateMachine) graph() map[State][]graphEdge {
+	graph := make(map[State][]graphEdge)
+	for _, name := range sm.eventNames {
+		for _, transition := range sm.events[name].Transitions {
+			graph[transition.From] = append(graph[transition.From], graphEdge{
+				event: name,
+				to:    transition.To,
+			})
+		}
+	}
+
+	return graph
+}
+
+// Cycles returns all simple cycles of the transition graph, ignoring
+// guards. Each cycle starts with its smallest state and doesn't repeat
+// it at the end, e.g. [authorized pending] for
+// pending -> authorized -> pending. Cycles are sorted.
+func (sm *StateMachine) Cycles() [][]State {
+	sm.mu.Lock()
+	graph := sm.graph()
+	states := sm.states()
+	sm.mu.Unlock()
+
+	// adjacency without duplicate edges between the same states
+	next := make(map[State][]State, len(graph))
+	for from, edges := range graph {
+		seen := map[State]bool{}
+		for _, edge := range edges {
+			if !seen[edge.to] {
+				seen[edge.to] = true
+				next[from] = append(next[from], edge.to)
+			}
+		}
+		sort.Slice(next[from], func(i, j int) bool { return next[from][i] < next[from][j] })
+	}
+
+	var cycles [][]State
+
+	// every cycle is found once, from its smallest state, by walking
+	// only through states greater than the start
+	for _, start := range states {
+		path := []State{start}
+		onPath := map[State]bool{start: true}
+
+		var walk func(state State)
+		walk = func(state State) {
+			for _, to := range next[state] {
+				switch {
+				case to == start:
+					cycle := make([]State, len(path))
+					copy(cycle, path)
+					cycles = append(cycles, cycle)
+				case to > start && !onPath[to]:
+					onPath[to] = true
+					path = append(path, to)
+					walk(to)
+					path = path[:len(path)-1]
+					onPath[to] = false
+				}
+			}
+		}
+
+		walk(start)
+	}
+
+	return cycles
+}
+
+// shortestPaths returns the shortest sequence of events leading from
+// the state to every state reachable from it, using a breadth-first
+// search. Ties are broken by event name.
+func shortestPaths(graph map[State][]graphEdge, from State) map[State][]string {
+	paths := map[State][]string{from: {}}
+	queue := []State{from}
+
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+
+		for _, edge := range graph[state] {
+			if _, visited := paths[edge.to]; visited {
+				continue
+			}
+
+			path := make([]string, len(paths[state]), len(paths[state])+1)
+			copy(path, paths[state])
+			paths[edge.to] = append(path, edge.event)
+
+			queue = append(queue, edge.to)
+		}
+	}
+
+	return paths
+}
+
+// ReachabilityReport lists which states can be reached from the
+// initial state of the machine
+type ReachabilityReport struct {
+	Initial State
+	States  []StateReachability
+}
+
+type StateReachability struct {
+	State     State
+	Reachable bool
+
+	// Path is the shortest sequence of events leading to the state
+	Path []string
+}
+
+// ReachabilityReport returns the reachability of every state from the
+// initial state, ignoring guards. States are sorted.
+func (sm *StateMachine) ReachabilityReport() ReachabilityReport {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	paths := shortestPaths(sm.graph(), sm.initialState)
+
+	report := ReachabilityReport{Initial: sm.initialState}
+	for _, state := range sm.states() {
+		path, reachable := paths[state]
+		report.States = append(report.States, StateReachability{
+			State:     state,
+			Reachable: reachable,
+			Path:      path,
+		})
+	}
+
+	return report
+}
+
+// PathTo returns the shortest sequence of events leading from the
+// current state to the target, ignoring guards, or false if the target
+// can't be reached
+func (sm *StateMachine) PathTo(target State) ([]string, bool) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	current, err := sm.loadState(context.Background())
+	if err != nil {
+		current = sm.currentState
+	}
+
+	path, ok := shortestPaths(sm.graph(), current)[target]
+
+	return path, ok
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCycles(t *testing.T) {
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(transferEvents(&Transfer{}))
+
+	require.Empty(t, sm.Cycles())
+
+	events := transferEvents(&Transfer{})
+	events["reset"] = Event{
+		Transitions: []Transition{
+			{From: StateAuthorized, To: StatePending},
+			{From: StateVoided, To: StateVoided},
+		},
+	}
+	sm.SetEvents(events)
+
+	require.Equal(t, [][]State{
+		{StateAuthorized, StatePending},
+		{StateVoided},
+	}, sm.Cycles())
+}
+
+func TestReachabilityReport(t *testing.T) {
+	events := transferEvents(&Transfer{})
+	events["refund"] = Event{
+		Transitions: []Transition{
+			{From: "settled", To: "refunded"},
+		},
+	}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(events)
+
+	require.Equal(t, ReachabilityReport{
+		Initial: StatePending,
+		States: []StateReachability{
+			{State: StateAuthorized, Reachable: true, Path: []string{"authorize"}},
+			{State: StateCaptured, Reachable: true, Path: []string{"authorize", "capture"}},
+			{State: StatePartiallyAuthorized, Reachable: true, Path: []string{"authorize", "void"}},
+			{State: StatePending, Reachable: true, Path: []string{}},
+			{State: "refunded"},
+			{State: "settled"},
+			{State: StateVoided, Reachable: true, Path: []string{"authorize", "void"}},
+		},
+	}, sm.ReachabilityReport())
+}
+
+func TestPathTo(t *testing.T) {
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(transferEvents(&Transfer{}))
+
+	path, ok := sm.PathTo(StateCaptured)
+	require.True(t, ok)
+	require.Equal(t, []string{"authorize", "capture"}, path)
+
+	sm = NewStateMachine(Options{
+		CurrentState: StateVoided,
+	})
+	sm.SetEvents(transferEvents(&Transfer{}))
+
+	_, ok = sm.PathTo(StateCaptured)
+	require.False(t, ok)
+}
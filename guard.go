@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// GuardContext gives guards access to the machine evaluating them
+type GuardContext struct {
+	ctx   context.Context
+	sm    *StateMachine
+	event string
+	from  State
+
+	subject any
+}
+
+// guardContext returns the GuardContext for the guards of the event
+// from the state. The caller must hold the lock.
+func (sm *StateMachine) guardContext(ctx context.Context, event string, from State) GuardContext {
+	return GuardContext{
+		ctx:   ctx,
+		sm:    sm,
+		event: event,
+		from:  from,
+
+		subject: sm.subject,
+	}
+}
+
+// Context returns the context of the fire, or a background context
+// when the guards are evaluated outside of a fire, e.g. by CanFire
+func (gc GuardContext) Context() context.Context {
+	if gc.ctx == nil {
+		return context.Background()
+	}
+
+	return gc.ctx
+}
+
+// Now returns the current time of the clock of the machine
+func (gc GuardContext) Now() time.Time {
+	return gc.sm.clock.Now()
+}
+
+// Event returns the name of the event being fired
+func (gc GuardContext) Event() string {
+	return gc.event
+}
+
+// From returns the current state of the machine
+func (gc GuardContext) From() State {
+	return gc.from
+}
+
+// Subject returns the subject of the machine, or its copy when the
+// guard is evaluated by a dry run
+func (gc GuardContext) Subject() any {
+	return gc.subject
+}
+
+// Attempts returns how many times the event was fired successfully
+// before, according to the history of the machine
+func (gc GuardContext) Attempts(event string) int {
+	var attempts int
+	for _, record := range gc.sm.history {
+		if record.Event == event {
+			attempts++
+		}
+	}
+
+	return attempts
+}
+
+// WithinWindow returns true if the current time of the guard context
+// is in the [start, end) window
+func WithinWindow(gc GuardContext, start, end time.Time) bool {
+	now := gc.Now()
+
+	return !now.Before(start) && now.Before(end)
+}
+
+// guarded returns true if the transition has a guard
+func (t Transition) guarded() bool {
+	return t.Guard != nil || t.ContextGuard != nil
+}
+
+// guardAllows evaluates the guards of the transition
+func (sm *StateMachine) guardAllows(gc GuardContext, transition Transition, args []any) bool {
+	allowed := true
+
+	err := sm.protect(gc.event, "Guard", func() error {
+		if transition.Guard != nil && !transition.Guard(args...) {
+			allowed = false
+			return nil
+		}
+
+		if transition.ContextGuard != nil && !transition.ContextGuard(gc, args...) {
+			allowed = false
+		}
+
+		return nil
+	})
+
+	// a panicking guard rejects the transition
+	if err != nil {
+		sm.handleError(gc.event, err)
+		return false
+	}
+
+	return allowed
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuardContextWithinWindow(t *testing.T) {
+	clock := newFakeClock()
+
+	// captures are allowed between 9 and 17
+	day := clock.Now()
+	opens := day.Add(9 * time.Hour)
+	closes := day.Add(17 * time.Hour)
+
+	sm := NewStateMachine(Options{
+		CurrentState: StateAuthorized,
+		Clock:        clock,
+	})
+	sm.SetEvents(map[string]Event{
+		"capture": {
+			Transitions: []Transition{
+				{
+					From: StateAuthorized,
+					To:   StateCaptured,
+					ContextGuard: func(gc GuardContext, args ...any) bool {
+						return WithinWindow(gc, opens, closes)
+					},
+				},
+			},
+		},
+	})
+
+	clock.Advance(8 * time.Hour)
+	err := sm.Fire("capture")
+	require.ErrorIs(t, err, ErrNoTransitionForEvent)
+	require.Equal(t, "guard rejected", sm.PermittedEventsExplained()["capture"])
+
+	clock.Advance(time.Hour)
+	err = sm.Fire("capture")
+	require.NoError(t, err)
+	require.Equal(t, StateCaptured, sm.State())
+}
+
+func TestGlobalGuard(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+	legalHold := false
+	errHoldService := fmt.Errorf("hold service unavailable")
+	var holdErr error
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		GlobalGuard: func(gc GuardContext, args ...any) (bool, error) {
+			if holdErr != nil {
+				return false, holdErr
+			}
+			return !legalHold, nil
+		},
+	})
+	sm.SetEvents(transferEvents(xfr))
+
+	require.NoError(t, sm.Fire("authorize", 100))
+
+	legalHold = true
+
+	require.ErrorIs(t, sm.Fire("capture"), ErrGuardRejected)
+	require.ErrorIs(t, sm.Fire("void", 50), ErrGuardRejected)
+	require.Equal(t, StateAuthorized, sm.State())
+	require.Equal(t, map[string]string{
+		"authorize": "global guard rejected",
+		"capture":   "global guard rejected",
+		"void":      "global guard rejected",
+	}, sm.PermittedEventsExplained(50))
+
+	holdErr = errHoldService
+	require.ErrorIs(t, sm.Fire("capture"), errHoldService)
+
+	legalHold, holdErr = false, nil
+	require.NoError(t, sm.Fire("capture"))
+}
+
+func TestGuardContextAttempts(t *testing.T) {
+	const (
+		StateRetrying State = "retrying"
+		StateFailed   State = "failed"
+	)
+
+	retry := func(gc GuardContext, args ...any) bool {
+		return gc.Attempts("capture_failed") < 2
+	}
+	fail := func(gc GuardContext, args ...any) bool {
+		return !retry(gc, args...)
+	}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StateAuthorized,
+	})
+	sm.SetEvents(map[string]Event{
+		"capture_failed": {
+			Transitions: []Transition{
+				{From: StateAuthorized, To: StateRetrying, ContextGuard: retry},
+				{From: StateRetrying, To: StateRetrying, ContextGuard: retry},
+				{From: StateRetrying, To: StateFailed, ContextGuard: fail},
+			},
+		},
+	})
+
+	require.NoError(t, sm.Fire("capture_failed"))
+	require.Equal(t, StateRetrying, sm.State())
+
+	require.NoError(t, sm.Fire("capture_failed"))
+	require.Equal(t, StateRetrying, sm.State())
+
+	require.NoError(t, sm.Fire("capture_failed"))
+	require.Equal(t, StateFailed, sm.State())
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// transferEvents returns the events of the transfer state machine used
+// in TestFSM
+func transferEvents(xfr *Transfer) map[string]Event {
+	return map[string]Event{
+		"authorize": {
+			Transitions: []Transition{
+				{
+					From: StatePending,
+					To:   StateAuthorized,
+					On: func(args ...any) error {
+						if len(args) == 0 {
+							return nil
+						}
+						xfr.AuthorizedAmount = args[0].(int)
+
+						return nil
+					},
+				},
+			},
+		},
+		"capture": {
+			Transitions: []Transition{
+				{
+					From: StateAuthorized,
+					To:   StateCaptured,
+				},
+			},
+		},
+		"void": {
+			Transitions: []Transition{
+				{
+					From: StateAuthorized,
+					To:   StatePartiallyAuthorized,
+					Guard: func(args ...any) bool {
+						if len(args) == 0 {
+							return false
+						}
+
+						return args[0].(int) < xfr.AuthorizedAmount
+					},
+					On: func(args ...any) error {
+						amount := args[0].(int)
+
+						xfr.VoidedAmount += amount
+						xfr.AuthorizedAmount -= amount
+
+						return nil
+					},
+				},
+				{
+					From: StateAuthorized,
+					To:   StateVoided,
+					Guard: func(args ...any) bool {
+						amount := xfr.AuthorizedAmount
+						if len(args) != 0 {
+							amount = args[0].(int)
+						}
+
+						return amount == xfr.AuthorizedAmount
+					},
+					On: func(args ...any) error {
+						amount := xfr.AuthorizedAmount
+						if len(args) != 0 {
+							amount = args[0].(int)
+						}
+
+						xfr.VoidedAmount += amount
+						xfr.AuthorizedAmount -= amount
+
+						return nil
+					},
+				},
+			},
+		},
+	}
+}
+
+func (t *Transfer) Clone() any {
+	clone := *t
+	return &clone
+}
+
+// transferSubjectEvents returns the events of the transfer state
+// machine updating the subject returned by SubjectOf instead of xfr, so
+// they can be projected
+func transferSubjectEvents(xfr *Transfer) map[string]Event {
+	events := transferEvents(xfr)
+
+	for name, event := range events {
+		transitions := make([]Transition, len(event.Transitions))
+		for i, transition := range event.Transitions {
+			transition.On = nil
+			transitions[i] = transition
+		}
+		event.Transitions = transitions
+		events[name] = event
+	}
+
+	void := func(ctx context.Context, args ...any) error {
+		transfer := SubjectOf(ctx).(*Transfer)
+
+		amount := transfer.AuthorizedAmount
+		if len(args) != 0 {
+			amount = args[0].(int)
+		}
+
+		transfer.VoidedAmount += amount
+		transfer.AuthorizedAmount -= amount
+
+		return nil
+	}
+
+	events["authorize"].Transitions[0].OnContext = func(ctx context.Context, args ...any) error {
+		SubjectOf(ctx).(*Transfer).AuthorizedAmount = args[0].(int)
+		return nil
+	}
+	events["capture"].Transitions[0].OnContext = func(ctx context.Context, args ...any) error {
+		transfer := SubjectOf(ctx).(*Transfer)
+		transfer.CapturedAmount = transfer.AuthorizedAmount
+		return nil
+	}
+	events["void"].Transitions[0].OnContext = void
+	events["void"].Transitions[1].OnContext = void
+
+	return events
+}
+
+// fakeRepository keeps states in memory and counts the calls
+type fakeRepository struct {
+	mu        sync.Mutex
+	states    map[string]State
+	loads     int
+	saves     int
+	commits   int
+	rollbacks int
+
+	saveErr   error
+	commitErr error
+
+	// afterCommit is called with the lock held once a transaction is
+	// committed, e.g. to change a state as another process would
+	afterCommit func(states map[string]State)
+}
+
+// fakeTxKey is the context key of the transaction of fakeRepository
+type fakeTxKey struct{}
+
+// fakeTx holds the states saved in the transaction until it's
+// committed
+type fakeTx struct {
+	states map[string]State
+}
+
+func newFakeRepository(states map[string]State) *fakeRepository {
+	return &fakeRepository{states: states}
+}
+
+func (r *fakeRepository) LoadState(ctx context.Context, id string) (State, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.loads++
+
+	if tx, ok := ctx.Value(fakeTxKey{}).(*fakeTx); ok {
+		if state, ok := tx.states[id]; ok {
+			return state, nil
+		}
+	}
+
+	return r.states[id], nil
+}
+
+func (r *fakeRepository) SaveState(ctx context.Context, id string, state State) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.saves++
+
+	if r.saveErr != nil {
+		return r.saveErr
+	}
+
+	if tx, ok := ctx.Value(fakeTxKey{}).(*fakeTx); ok {
+		tx.states[id] = state
+		return nil
+	}
+
+	r.states[id] = state
+
+	return nil
+}
+
+func (r *fakeRepository) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx := &fakeTx{states: map[string]State{}}
+
+	err := fn(context.WithValue(ctx, fakeTxKey{}, tx))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err == nil {
+		err = r.commitErr
+	}
+
+	if err != nil {
+		r.rollbacks++
+		return err
+	}
+
+	for id, state := range tx.states {
+		r.states[id] = state
+	}
+	r.commits++
+
+	if r.afterCommit != nil {
+		r.afterCommit(r.states)
+	}
+
+	return nil
+}
+
+// committed returns the committed state of the subject
+func (r *fakeRepository) committed(id string) State {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.states[id]
+}
+
+// fakeClock is a Clock that only moves when advanced. Timers due are
+// called synchronously by Advance.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	timer := &fakeTimer{clock: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, timer)
+
+	return timer
+}
+
+// Advance moves the clock forward and calls the timers that are due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+
+	var due, pending []*fakeTimer
+	for _, timer := range c.timers {
+		if !timer.at.After(c.now) {
+			due = append(due, timer)
+		} else {
+			pending = append(pending, timer)
+		}
+	}
+	c.timers = pending
+	c.mu.Unlock()
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].at.Before(due[j].at)
+	})
+
+	for _, timer := range due {
+		timer.f()
+	}
+}
+
+type fakeTimer struct {
+	clock *fakeClock
+	at    time.Time
+	f     func()
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	for i, timer := range t.clock.timers {
+		if timer == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// DefaultStateSeparator separates the parent and child parts of
+// hierarchical states, e.g. authorized.review
+const DefaultStateSeparator = "."
+
+// IsChildOf returns true if the state is a substate, at any depth, of
+// the parent
+func (sm *StateMachine) IsChildOf(state, parent State) bool {
+	return strings.HasPrefix(string(state), string(parent)+sm.separator())
+}
+
+func (sm *StateMachine) separator() string {
+	if sm.stateSeparator == "" {
+		return DefaultStateSeparator
+	}
+
+	return sm.stateSeparator
+}
+
+// matchesFrom returns true if a transition from the state can be taken
+// in the current state. With hierarchical states, transitions from a
+// parent state are taken in all of its substates.
+func (sm *StateMachine) matchesFrom(current, from State) bool {
+	if current == from {
+		return true
+	}
+
+	return sm.hierarchical && sm.IsChildOf(current, from)
+}
+
+// states returns all states used by the transitions and the initial
+// state, sorted
+func (sm *StateMachine) states() []State {
+	seen := map[State]bool{}
+	if sm.currentState != "" {
+		seen[sm.currentState] = true
+	}
+
+	for _, event := range sm.events {
+		for _, transition := range event.Transitions {
+			seen[transition.From] = true
+			seen[transition.To] = true
+		}
+	}
+
+	states := make([]State, 0, len(seen))
+	for state := range seen {
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i] < states[j] })
+
+	return states
+}
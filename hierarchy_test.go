@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHierarchicalStatesWithSeparator(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	sm := NewStateMachine(Options{
+		CurrentState:   "authorized/review",
+		Hierarchical:   true,
+		StateSeparator: "/",
+	})
+	sm.SetEvents(transferEvents(xfr))
+
+	require.True(t, sm.IsChildOf("authorized/review", StateAuthorized))
+	require.True(t, sm.IsChildOf("authorized/review/manual", StateAuthorized))
+	require.False(t, sm.IsChildOf("authorized.review", StateAuthorized))
+	require.False(t, sm.IsChildOf(StateAuthorized, StateAuthorized))
+
+	require.NoError(t, sm.Validate(ValidateOptions{}))
+
+	// the capture transition from authorized is taken in the substate
+	err := sm.Fire("capture")
+	require.NoError(t, err)
+	require.Equal(t, StateCaptured, sm.State())
+}
+
+func TestValidateSeparatorWithoutHierarchy(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	sm := NewStateMachine(Options{
+		CurrentState: "authorized.review",
+	})
+	sm.SetEvents(transferEvents(xfr))
+
+	err := sm.Fire("capture")
+	require.ErrorIs(t, err, ErrNoTransitionForEvent)
+
+	err = sm.Validate(ValidateOptions{})
+	require.EqualError(t, err, `invalid state machine: state authorized.review contains separator "." but hierarchical states are disabled`)
+}
@@ -0,0 +1,107 @@
+package main
+
+import "time"
+
+// TransitionRecord is an entry of the history of the machine
+type TransitionRecord struct {
+	// ID identifies the transition as <subject id>/<random id>, so
+	// it's unique across machines and restarts
+	ID string
+
+	// CausedBy is the ID of the transition that fired this automatic
+	// transition. It's empty for transitions fired by the caller.
+	CausedBy string
+
+	// BatchID is the ID of the batch the transition was fired in, see
+	// StartBatch
+	BatchID string
+
+	Event string
+	From  State
+	To    State
+	Args  []any
+	At    time.Time
+
+	// Warnings are the reasons of the soft guards that flagged the
+	// transition
+	Warnings []string
+
+	// Diff lists the fields of the subject changed by the transition
+	// when subject diffs are enabled
+	Diff SubjectDiff
+
+	// Error is the error of a failed fire. Failed fires are only
+	// recorded by the HistoryStore, see Options.HistoryStore.
+	Error string
+}
+
+// History returns the successful transitions of the machine, oldest
+// first
+func (sm *StateMachine) History() []TransitionRecord {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	history := make([]TransitionRecord, len(sm.history))
+	copy(history, sm.history)
+
+	return history
+}
+
+// LastEvent returns the name of the event of the last successful
+// transition and false if there is none
+func (sm *StateMachine) LastEvent() (string, bool) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if len(sm.history) == 0 {
+		return "", false
+	}
+
+	return sm.history[len(sm.history)-1].Event, true
+}
+
+// HistoryDiff is a difference between two histories
+type HistoryDiff struct {
+	// Index of the first record that differs
+	Index int
+
+	// Field that differs: event, from, to or, when one history is
+	// shorter, record
+	Field string
+
+	A string
+	B string
+}
+
+// DiffHistory compares two histories, e.g. the original one and the one
+// of a replayed machine. It returns the differences of the first
+// record that differs, or nil if the histories are the same. Only the
+// event and states are compared.
+func DiffHistory(a, b []TransitionRecord) []HistoryDiff {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		if i >= len(a) {
+			return []HistoryDiff{{Index: i, Field: "record", B: b[i].Event}}
+		}
+		if i >= len(b) {
+			return []HistoryDiff{{Index: i, Field: "record", A: a[i].Event}}
+		}
+
+		var diffs []HistoryDiff
+
+		if a[i].Event != b[i].Event {
+			diffs = append(diffs, HistoryDiff{Index: i, Field: "event", A: a[i].Event, B: b[i].Event})
+		}
+		if a[i].From != b[i].From {
+			diffs = append(diffs, HistoryDiff{Index: i, Field: "from", A: string(a[i].From), B: string(b[i].From)})
+		}
+		if a[i].To != b[i].To {
+			diffs = append(diffs, HistoryDiff{Index: i, Field: "to", A: string(a[i].To), B: string(b[i].To)})
+		}
+
+		if len(diffs) > 0 {
+			return diffs
+		}
+	}
+
+	return nil
+}
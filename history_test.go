@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffHistory(t *testing.T) {
+	original := []TransitionRecord{
+		{Event: "authorize", From: StatePending, To: StateAuthorized},
+		{Event: "void", From: StateAuthorized, To: StatePartiallyAuthorized},
+		{Event: "capture", From: StatePartiallyAuthorized, To: StateCaptured},
+	}
+	replayed := []TransitionRecord{
+		{Event: "authorize", From: StatePending, To: StateAuthorized},
+		{Event: "void", From: StateAuthorized, To: StateVoided},
+	}
+
+	require.Nil(t, DiffHistory(original, original))
+
+	require.Equal(t, []HistoryDiff{
+		{Index: 1, Field: "to", A: "partially_authorized", B: "voided"},
+	}, DiffHistory(original, replayed))
+
+	require.Equal(t, []HistoryDiff{
+		{Index: 2, Field: "record", A: "capture"},
+	}, DiffHistory(original, original[:2]))
+}
+
+func TestLastEvent(t *testing.T) {
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(transferEvents(&Transfer{}))
+
+	_, ok := sm.LastEvent()
+	require.False(t, ok)
+
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.NoError(t, sm.Fire("void", 50))
+
+	// failed fires don't change the last event
+	require.Error(t, sm.Fire("capture"))
+
+	event, ok := sm.LastEvent()
+	require.True(t, ok)
+	require.Equal(t, "void", event)
+}
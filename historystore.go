@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// HistoryStore persists the history of the subjects, e.g. as the
+// audit trail of a transfer or as the events of an event sourced
+// storage. Transitions are appended once they are committed, so the
+// store only has transitions that happened, and failed fires are
+// appended with their Error. Errors of Append are passed to the error
+// handler of the machine, see Options.ErrorHandler.
+type HistoryStore interface {
+	Append(ctx context.Context, subjectID string, record TransitionRecord) error
+
+	// Load returns the records of the subject, oldest first
+	Load(ctx context.Context, subjectID string) ([]TransitionRecord, error)
+}
+
+// MemoryHistoryStore keeps the history of the subjects in memory
+type MemoryHistoryStore struct {
+	mu      sync.Mutex
+	records map[string][]TransitionRecord
+}
+
+func NewMemoryHistoryStore() *MemoryHistoryStore {
+	return &MemoryHistoryStore{
+		records: make(map[string][]TransitionRecord),
+	}
+}
+
+func (s *MemoryHistoryStore) Append(ctx context.Context, subjectID string, record TransitionRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[subjectID] = append(s.records[subjectID], record)
+
+	return nil
+}
+
+func (s *MemoryHistoryStore) Load(ctx context.Context, subjectID string) ([]TransitionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := make([]TransitionRecord, len(s.records[subjectID]))
+	copy(records, s.records[subjectID])
+
+	return records, nil
+}
+
+// ReplayHistory rebuilds the subject and the state by replaying the
+// transitions of the subject recorded by the HistoryStore, see Replay.
+// Failed fires are skipped. The machine must be in the state the
+// history starts from, e.g. created with the initial state and without
+// a Repository holding the final one.
+func (sm *StateMachine) ReplayHistory(ctx context.Context) error {
+	sm.lockFire()
+	defer sm.unlockFire()
+
+	if sm.histories == nil {
+		return fmt.Errorf("replaying history: no history store")
+	}
+
+	records, err := sm.histories.Load(ctx, sm.subjectID)
+	if err != nil {
+		return fmt.Errorf("loading history: %w", err)
+	}
+
+	return sm.replay(ctx, records)
+}
+
+// recordTransition appends the committed transition to the
+// HistoryStore. Replayed transitions are already recorded. The
+// transition is committed, so an error of the store is passed to the
+// error handler instead of failing the fire. The caller must hold the
+// lock.
+func (sm *StateMachine) recordTransition(ctx context.Context, record TransitionRecord) {
+	if sm.histories == nil || IsReplay(ctx) {
+		return
+	}
+
+	if err := sm.histories.Append(ctx, sm.subjectID, record); err != nil {
+		sm.handleError(record.Event, fmt.Errorf("recording transition %s: %w", record.ID, err))
+	}
+}
+
+// recordFailure appends the failed fire to the HistoryStore. The fire
+// already failed, so an error of the store is ignored. The caller must
+// hold the lock.
+func (sm *StateMachine) recordFailure(ctx context.Context, trace *fireTrace, name string, args []any, err error) {
+	if sm.histories == nil || IsReplay(ctx) {
+		return
+	}
+
+	record := TransitionRecord{
+		BatchID: trace.batch,
+		Event:   name,
+		From:    trace.from,
+		Args:    args,
+		At:      sm.clock.Now(),
+		Error:   err.Error(),
+	}
+	if trace.transition != nil {
+		record.To = trace.transition.To
+	}
+
+	_ = sm.histories.Append(ctx, sm.subjectID, record)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryStore(t *testing.T) {
+	store := NewMemoryHistoryStore()
+	xfr := &Transfer{}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		SubjectID:    "xfr",
+		HistoryStore: store,
+	})
+	sm.SetEvents(transferEvents(xfr))
+
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.ErrorIs(t, sm.Fire("void", 200), ErrNoTransitionForEvent)
+	require.NoError(t, sm.Fire("void", 40))
+
+	records, err := store.Load(context.Background(), "xfr")
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+
+	require.Regexp(t, `^xfr/[0-9a-f]{16}$`, records[0].ID)
+	require.Equal(t, StateAuthorized, records[0].To)
+	require.Empty(t, records[0].Error)
+
+	require.Equal(t, "void", records[1].Event)
+	require.Equal(t, StateAuthorized, records[1].From)
+	require.Equal(t, []any{200}, records[1].Args)
+	require.Contains(t, records[1].Error, ErrNoTransitionForEvent.Error())
+
+	require.NotEqual(t, records[0].ID, records[2].ID)
+	require.Equal(t, StatePartiallyAuthorized, records[2].To)
+
+	// the history of the machine has only the transitions
+	require.Equal(t, []TransitionRecord{records[0], records[2]}, sm.History())
+
+	t.Run("replay", func(t *testing.T) {
+		replayed := &Transfer{}
+
+		sm := NewStateMachine(Options{
+			CurrentState: StatePending,
+			SubjectID:    "xfr",
+			HistoryStore: store,
+		})
+		sm.SetEvents(transferEvents(replayed))
+
+		require.NoError(t, sm.ReplayHistory(context.Background()))
+		require.Equal(t, StatePartiallyAuthorized, sm.State())
+		require.Equal(t, *xfr, *replayed)
+
+		// replayed transitions are not recorded again
+		records, err := store.Load(context.Background(), "xfr")
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+	})
+
+	t.Run("append fails", func(t *testing.T) {
+		var handled []error
+
+		sm := NewStateMachine(Options{
+			CurrentState: StatePending,
+			SubjectID:    "xfr",
+			HistoryStore: failingHistoryStore{},
+			ErrorHandler: func(event string, err error) error {
+				handled = append(handled, err)
+				return err
+			},
+		})
+		sm.SetEvents(transferEvents(&Transfer{}))
+
+		// the transition is committed before it's recorded
+		require.NoError(t, sm.Fire("authorize", 100))
+		require.Equal(t, StateAuthorized, sm.State())
+		require.Len(t, handled, 1)
+		require.ErrorContains(t, handled[0], "recording transition")
+	})
+
+	t.Run("commit fails", func(t *testing.T) {
+		store := NewMemoryHistoryStore()
+		repo := newFakeRepository(map[string]State{"xfr": StatePending})
+		repo.commitErr = fmt.Errorf("serialization failure")
+
+		sm := NewStateMachine(Options{
+			Repository:   repo,
+			SubjectID:    "xfr",
+			HistoryStore: store,
+		})
+		sm.SetEvents(transferEvents(&Transfer{}))
+
+		require.Error(t, sm.Fire("authorize", 100))
+
+		// only the failed fire is recorded
+		records, err := store.Load(context.Background(), "xfr")
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		require.Contains(t, records[0].Error, "serialization failure")
+	})
+}
+
+func TestReplayHistoryWithoutStore(t *testing.T) {
+	sm := NewStateMachine(Options{CurrentState: StatePending})
+
+	require.Error(t, sm.ReplayHistory(context.Background()))
+}
+
+// failingHistoryStore fails to append records
+type failingHistoryStore struct{}
+
+func (failingHistoryStore) Append(context.Context, string, TransitionRecord) error {
+	return fmt.Errorf("store unavailable")
+}
+
+func (failingHistoryStore) Load(context.Context, string) ([]TransitionRecord, error) {
+	return nil, nil
+}
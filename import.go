@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var ErrUnknownState = fmt.Errorf("unknown state")
+
+// RowError is the error of a single row of an import
+type RowError struct {
+	Line int
+	ID   string
+	Err  error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("line %d: %s: %s", e.Line, e.ID, e.Err)
+}
+
+func (e RowError) Unwrap() error {
+	return e.Err
+}
+
+// ImportError lists the rows that were not imported
+type ImportError struct {
+	Rows []RowError
+}
+
+func (e *ImportError) Error() string {
+	msgs := make([]string, len(e.Rows))
+	for i, row := range e.Rows {
+		msgs[i] = row.Error()
+	}
+
+	return fmt.Sprintf("%d rows not imported: %s", len(e.Rows), strings.Join(msgs, "; "))
+}
+
+// States returns all states of the machine: the states used by the
+// transitions and the initial state
+func (sm *StateMachine) States() []State {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	return sm.states()
+}
+
+// ImportStatesCSV reads id,state rows and calls apply for every row
+// whose state is one of the known states, e.g. sm.States(). An optional
+// id,state header is skipped. It returns the number of applied rows and
+// an *ImportError listing the rows with unknown states, with another
+// number of fields than two or that failed to apply. Reading stops at
+// the first line that can't be parsed, e.g. with an unterminated quote.
+func ImportStatesCSV(r io.Reader, known []State, apply func(id string, state State) error) (int, error) {
+	knownStates := make(map[State]bool, len(known))
+	for _, state := range known {
+		knownStates[state] = true
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	var applied int
+	var rowErrors []RowError
+
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, csv.ErrFieldCount) {
+			var id string
+			if len(record) > 0 {
+				id = record[0]
+			}
+			rowErrors = append(rowErrors, RowError{Line: line, ID: id, Err: csv.ErrFieldCount})
+			continue
+		}
+		if err != nil {
+			return applied, fmt.Errorf("reading csv: %w", err)
+		}
+
+		if line == 1 && record[0] == "id" && record[1] == "state" {
+			continue
+		}
+
+		id, state := record[0], State(record[1])
+
+		if !knownStates[state] {
+			rowErrors = append(rowErrors, RowError{
+				Line: line,
+				ID:   id,
+				Err:  fmt.Errorf("%w: %s", ErrUnknownState, state),
+			})
+			continue
+		}
+
+		if err := apply(id, state); err != nil {
+			rowErrors = append(rowErrors, RowError{Line: line, ID: id, Err: err})
+			continue
+		}
+
+		applied++
+	}
+
+	if len(rowErrors) > 0 {
+		return applied, &ImportError{Rows: rowErrors}
+	}
+
+	return applied, nil
+}
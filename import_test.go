@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportStatesCSV(t *testing.T) {
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(transferEvents(&Transfer{}))
+
+	csv := `id,state
+xfr1,authorized
+xfr2,refunded
+xfr3,captured
+`
+
+	applied := map[string]State{}
+
+	n, err := ImportStatesCSV(strings.NewReader(csv), sm.States(), func(id string, state State) error {
+		applied[id] = state
+		return nil
+	})
+	require.Equal(t, 2, n)
+	require.Equal(t, map[string]State{
+		"xfr1": StateAuthorized,
+		"xfr3": StateCaptured,
+	}, applied)
+
+	var importErr *ImportError
+	require.True(t, errors.As(err, &importErr))
+	require.Len(t, importErr.Rows, 1)
+	require.Equal(t, 3, importErr.Rows[0].Line)
+	require.Equal(t, "xfr2", importErr.Rows[0].ID)
+	require.ErrorIs(t, importErr.Rows[0], ErrUnknownState)
+}
+
+func TestImportStatesCSVFieldCount(t *testing.T) {
+	rows := `xfr1,authorized
+xfr2,captured,extra
+xfr3
+xfr4,voided
+`
+
+	var applied []string
+
+	n, err := ImportStatesCSV(strings.NewReader(rows), []State{StateAuthorized, StateCaptured, StateVoided}, func(id string, state State) error {
+		applied = append(applied, id)
+		return nil
+	})
+	require.Equal(t, 2, n)
+	require.Equal(t, []string{"xfr1", "xfr4"}, applied)
+
+	var importErr *ImportError
+	require.True(t, errors.As(err, &importErr))
+	require.Len(t, importErr.Rows, 2)
+	require.Equal(t, 2, importErr.Rows[0].Line)
+	require.Equal(t, "xfr2", importErr.Rows[0].ID)
+	require.Equal(t, 3, importErr.Rows[1].Line)
+	require.Equal(t, "xfr3", importErr.Rows[1].ID)
+	require.ErrorIs(t, importErr.Rows[1], csv.ErrFieldCount)
+}
@@ -0,0 +1,37 @@
+package main
+
+import "fmt"
+
+var ErrSubjectCorrupt = fmt.Errorf("subject corrupt")
+
+// IntegrityChecker is implemented by subjects that can verify their
+// own data, e.g. with a checksum of the persisted fields
+type IntegrityChecker interface {
+	Integrity() error
+}
+
+// checkIntegrity returns ErrSubjectCorrupt if integrity checks are
+// enabled and the subject fails its check. The caller must hold the
+// lock.
+func (sm *StateMachine) checkIntegrity(name string, subject any) error {
+	if !sm.checkSubjectIntegrity {
+		return nil
+	}
+
+	checker, ok := subject.(IntegrityChecker)
+	if !ok {
+		return nil
+	}
+
+	var err error
+
+	sm.notify(name, "Integrity", func() {
+		err = checker.Integrity()
+	})
+
+	if err != nil {
+		return fmt.Errorf("event %s: %w: %s", name, ErrSubjectCorrupt, err)
+	}
+
+	return nil
+}
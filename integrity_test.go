@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// checksummedTransfer is a transfer with a checksum of its amounts
+type checksummedTransfer struct {
+	Transfer
+	Checksum int
+}
+
+func (t *checksummedTransfer) Integrity() error {
+	if sum := t.AuthorizedAmount + t.CapturedAmount + t.VoidedAmount; sum != t.Checksum {
+		return fmt.Errorf("checksum %d doesn't match amounts %d", t.Checksum, sum)
+	}
+
+	return nil
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	xfr := &checksummedTransfer{Checksum: 100}
+	xfr.AuthorizedAmount = 90
+
+	var guarded bool
+
+	sm := NewStateMachine(Options{
+		CurrentState:   StateAuthorized,
+		Subject:        xfr,
+		CheckIntegrity: true,
+	})
+	sm.SetEvents(map[string]Event{
+		"capture": {
+			Transitions: []Transition{{
+				From: StateAuthorized,
+				To:   StateCaptured,
+				Guard: func(args ...any) bool {
+					guarded = true
+					return true
+				},
+			}},
+		},
+	})
+
+	err := sm.Fire("capture")
+	require.ErrorIs(t, err, ErrSubjectCorrupt)
+	require.EqualError(t, err, "event capture: subject corrupt: checksum 100 doesn't match amounts 90")
+	require.False(t, guarded)
+	require.Equal(t, StateAuthorized, sm.State())
+
+	xfr.AuthorizedAmount = 100
+
+	require.NoError(t, sm.Fire("capture"))
+	require.Equal(t, StateCaptured, sm.State())
+}
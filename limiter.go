@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// EventLimiter caps the number of concurrent On calls per event name
+// across all machines sharing it
+type EventLimiter struct {
+	mu     sync.Mutex
+	limits map[string]int
+	slots  map[string]chan struct{}
+}
+
+// NewEventLimiter returns a limiter allowing at most limits[event]
+// concurrent On calls of the event. Events without a limit are not
+// limited. A limit of zero or less pauses the event: its On calls wait
+// until their context is done, so fires fail with the error of the
+// context, e.g. to hold off the captures while the gateway is down.
+func NewEventLimiter(limits map[string]int) *EventLimiter {
+	return &EventLimiter{
+		limits: limits,
+		slots:  make(map[string]chan struct{}),
+	}
+}
+
+func (l *EventLimiter) semaphore(event string) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit, ok := l.limits[event]
+	if !ok {
+		return nil
+	}
+
+	slots, ok := l.slots[event]
+	if !ok {
+		if limit < 0 {
+			limit = 0
+		}
+		slots = make(chan struct{}, limit)
+		l.slots[event] = slots
+	}
+
+	return slots
+}
+
+// Acquire waits for a free slot of the event or for the context to be
+// done
+func (l *EventLimiter) Acquire(ctx context.Context, event string) error {
+	slots := l.semaphore(event)
+	if slots == nil {
+		return nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release frees the slot of the event acquired by Acquire
+func (l *EventLimiter) Release(event string) {
+	slots := l.semaphore(event)
+	if slots == nil {
+		return
+	}
+
+	<-slots
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventLimiter(t *testing.T) {
+	limiter := NewEventLimiter(map[string]int{"capture": 1})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	newMachine := func(on func(args ...any) error) *StateMachine {
+		sm := NewStateMachine(Options{
+			CurrentState: StateAuthorized,
+			EventLimiter: limiter,
+		})
+		sm.SetEvents(map[string]Event{
+			"capture": {
+				Transitions: []Transition{
+					{From: StateAuthorized, To: StateCaptured, On: on},
+				},
+			},
+		})
+
+		return sm
+	}
+
+	first := newMachine(func(args ...any) error {
+		close(started)
+		<-release
+		return nil
+	})
+	second := newMachine(nil)
+	third := newMachine(func(args ...any) error { return nil })
+
+	done := make(chan error)
+	go func() {
+		done <- first.Fire("capture")
+	}()
+	<-started
+
+	// the first capture holds the only slot, so the next one times out
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := third.FireContext(ctx, "capture")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, StateAuthorized, third.State())
+
+	// transitions without On are not limited
+	require.NoError(t, second.Fire("capture"))
+
+	waiting := make(chan error)
+	go func() {
+		waiting <- third.Fire("capture")
+	}()
+
+	select {
+	case <-waiting:
+		t.Fatal("capture didn't wait for the limit")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(release)
+	require.NoError(t, <-done)
+	require.NoError(t, <-waiting)
+	require.Equal(t, StateCaptured, third.State())
+}
+
+func TestEventLimiterReleasedOnPanic(t *testing.T) {
+	limiter := NewEventLimiter(map[string]int{"capture": 1})
+
+	newMachine := func(on func(args ...any) error) *StateMachine {
+		sm := NewStateMachine(Options{
+			CurrentState: StateAuthorized,
+			EventLimiter: limiter,
+		})
+		sm.SetEvents(map[string]Event{
+			"capture": {
+				Transitions: []Transition{
+					{From: StateAuthorized, To: StateCaptured, On: on},
+				},
+			},
+		})
+
+		return sm
+	}
+
+	panicking := newMachine(func(args ...any) error {
+		panic("gateway client bug")
+	})
+	require.Panics(t, func() { _ = panicking.Fire("capture") })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// the slot of the panicking On is free
+	sm := newMachine(func(args ...any) error { return nil })
+	require.NoError(t, sm.FireContext(ctx, "capture"))
+}
+
+func TestEventLimiterPaused(t *testing.T) {
+	for _, limit := range []int{0, -1} {
+		limiter := NewEventLimiter(map[string]int{"capture": limit})
+
+		var called bool
+
+		sm := NewStateMachine(Options{
+			CurrentState: StateAuthorized,
+			EventLimiter: limiter,
+		})
+		sm.SetEvents(map[string]Event{
+			"capture": {
+				Transitions: []Transition{{
+					From: StateAuthorized,
+					To:   StateCaptured,
+					On: func(args ...any) error {
+						called = true
+						return nil
+					},
+				}},
+			},
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+
+		err := sm.FireContext(ctx, "capture")
+		cancel()
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.False(t, called)
+		require.Equal(t, StateAuthorized, sm.State())
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+var ErrLockTimeout = fmt.Errorf("timed out waiting for subject lock")
+
+// defaultLockRetryInterval is how often a lock without fairness is
+// retried
+const defaultLockRetryInterval = 10 * time.Millisecond
+
+// SubjectLocker locks subjects across processes, e.g. with a database
+// advisory lock, so only one process fires events of a subject at a
+// time
+type SubjectLocker interface {
+	// TryLock acquires the lock of the subject if it's free. It returns
+	// false if the lock is held by someone else.
+	TryLock(ctx context.Context, id string) (unlock func(), ok bool, err error)
+}
+
+// FairSubjectLocker is a SubjectLocker granting the lock in the order
+// it was requested. Fire queues for the lock instead of retrying
+// TryLock when the locker implements it.
+type FairSubjectLocker interface {
+	SubjectLocker
+
+	// Lock waits in line for the lock of the subject until it's
+	// acquired or the context is done
+	Lock(ctx context.Context, id string) (unlock func(), err error)
+}
+
+// lockSubject acquires the lock of the subject, waiting at most
+// lockWait. It returns ErrLockTimeout if the wait is over. The caller
+// must hold the lock of the machine.
+func (sm *StateMachine) lockSubject(ctx context.Context) (func(), error) {
+	if sm.lockWait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+
+		timer := sm.clock.AfterFunc(sm.lockWait, cancel)
+		defer timer.Stop()
+	}
+
+	if fair, ok := sm.locker.(FairSubjectLocker); ok {
+		unlock, err := fair.Lock(ctx, sm.subjectID)
+		if err != nil {
+			return nil, sm.lockError(ctx, err)
+		}
+
+		return unlock, nil
+	}
+
+	for {
+		unlock, ok, err := sm.locker.TryLock(ctx, sm.subjectID)
+		if err != nil {
+			return nil, sm.lockError(ctx, err)
+		}
+		if ok {
+			return unlock, nil
+		}
+
+		retry := make(chan struct{})
+		timer := sm.clock.AfterFunc(sm.lockRetry, func() { close(retry) })
+
+		select {
+		case <-retry:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, sm.lockError(ctx, ctx.Err())
+		}
+	}
+}
+
+// lockError converts the error of the locker caused by the end of the
+// wait into ErrLockTimeout
+func (sm *StateMachine) lockError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("subject %s: %w", sm.subjectID, ErrLockTimeout)
+	}
+
+	return fmt.Errorf("locking subject %s: %w", sm.subjectID, err)
+}
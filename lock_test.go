@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeFairLock is a FairSubjectLocker granting a single lock in FIFO
+// order
+type fakeFairLock struct {
+	mu      sync.Mutex
+	held    bool
+	waiters []chan struct{}
+}
+
+func (l *fakeFairLock) TryLock(ctx context.Context, id string) (func(), bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.held {
+		return nil, false, nil
+	}
+	l.held = true
+
+	return l.unlock, true, nil
+}
+
+func (l *fakeFairLock) Lock(ctx context.Context, id string) (func(), error) {
+	l.mu.Lock()
+	if !l.held {
+		l.held = true
+		l.mu.Unlock()
+		return l.unlock, nil
+	}
+
+	granted := make(chan struct{})
+	l.waiters = append(l.waiters, granted)
+	l.mu.Unlock()
+
+	select {
+	case <-granted:
+		return l.unlock, nil
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, waiter := range l.waiters {
+		if waiter == granted {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			return nil, ctx.Err()
+		}
+	}
+
+	// the lock was granted meanwhile, so it's passed on
+	l.release()
+
+	return nil, ctx.Err()
+}
+
+func (l *fakeFairLock) unlock() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.release()
+}
+
+func (l *fakeFairLock) release() {
+	if len(l.waiters) == 0 {
+		l.held = false
+		return
+	}
+
+	close(l.waiters[0])
+	l.waiters = l.waiters[1:]
+}
+
+func (l *fakeFairLock) waiting() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.waiters)
+}
+
+func TestSubjectLockFairness(t *testing.T) {
+	lock := &fakeFairLock{}
+
+	var mu sync.Mutex
+	var order []string
+
+	// machines of the same subject in different processes
+	machine := func(process string) *StateMachine {
+		sm := NewStateMachine(Options{
+			CurrentState:  StatePending,
+			SubjectID:     "xfr",
+			SubjectLocker: lock,
+		})
+		sm.SetEvents(map[string]Event{
+			"authorize": {
+				Transitions: []Transition{{
+					From: StatePending,
+					To:   StateAuthorized,
+					On: func(args ...any) error {
+						mu.Lock()
+						defer mu.Unlock()
+						order = append(order, process)
+						return nil
+					},
+				}},
+			},
+		})
+		return sm
+	}
+
+	unlock, err := lock.Lock(context.Background(), "xfr")
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i, process := range []string{"first", "second", "third"} {
+		sm := machine(process)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, sm.Fire("authorize"))
+		}()
+
+		waiting := i + 1
+		require.Eventually(t, func() bool { return lock.waiting() == waiting }, time.Second, time.Millisecond)
+	}
+
+	unlock()
+	wg.Wait()
+
+	require.Equal(t, []string{"first", "second", "third"}, order)
+}
+
+func TestSubjectLockTimeout(t *testing.T) {
+	lock := &fakeFairLock{}
+
+	sm := NewStateMachine(Options{
+		CurrentState:  StatePending,
+		SubjectID:     "xfr",
+		SubjectLocker: lock,
+		LockWait:      20 * time.Millisecond,
+	})
+	sm.SetEvents(transferEvents(&Transfer{}))
+
+	unlock, err := lock.Lock(context.Background(), "xfr")
+	require.NoError(t, err)
+
+	require.ErrorIs(t, sm.Fire("authorize", 100), ErrLockTimeout)
+	require.Equal(t, StatePending, sm.State())
+	require.Zero(t, lock.waiting())
+
+	unlock()
+
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.Equal(t, StateAuthorized, sm.State())
+}
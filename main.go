@@ -1,5 +1,68 @@
 package main
 
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
 func main() {
+	if len(os.Args) < 2 {
+		return
+	}
+
+	switch os.Args[1] {
+	case "compile":
+		if err := compileCommand(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %s\n", os.Args[1])
+		os.Exit(2)
+	}
+}
+
+// compileCommand generates the source of a compiled machine from a
+// bundle exported by ExportBundle, e.g.
+//
+//	go run . compile -bundle transfers.json -pkg transfers -type Transfers -out transfers_fsm.go
+func compileCommand(args []string) error {
+	flags := flag.NewFlagSet("compile", flag.ContinueOnError)
+	bundlePath := flags.String("bundle", "", "path of the bundle with the definition")
+	pkg := flags.String("pkg", "main", "package of the generated source")
+	typeName := flags.String("type", "CompiledMachine", "name of the generated type")
+	out := flags.String("out", "", "path of the generated source, stdout if empty")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *bundlePath == "" {
+		return fmt.Errorf("-bundle is required")
+	}
+
+	data, err := os.ReadFile(*bundlePath)
+	if err != nil {
+		return fmt.Errorf("reading bundle: %w", err)
+	}
+
+	// the functions are only referenced by name, so they don't have to
+	// be registered
+	sm, err := ImportBundle(data, NewRegistry())
+	if err != nil {
+		return err
+	}
+
+	source, err := sm.ToCompiledSource(*pkg, *typeName)
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		_, err = fmt.Print(source)
+		return err
+	}
 
+	return os.WriteFile(*out, []byte(source), 0o644)
 }
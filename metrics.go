@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Metrics counts the transitions of the machine. States are passed as
+// strings so implementations don't depend on this package.
+type Metrics interface {
+	TransitionCompleted(event, from, to string)
+
+	// TransitionFailed counts failed fires by the reason of the
+	// failure, one of the Failure constants
+	TransitionFailed(event, reason string)
+}
+
+// reasons of failed fires reported to Metrics
+const (
+	FailureGuard        = "guard"
+	FailureInvalidState = "invalid_state"
+	FailureOnError      = "on_error"
+	FailureAfterError   = "after_error"
+	FailureInvalidInput = "invalid_input"
+	FailureTimeout      = "timeout"
+	FailureLock         = "lock_error"
+	FailureNoHandler    = "no_handler"
+	FailureUnauthorized = "unauthorized"
+	FailurePersistence  = "persistence"
+	FailureClosed       = "closed"
+	FailureStaleVersion = "stale_version"
+	FailureRateLimited  = "rate_limited"
+	FailureCorrupt      = "corrupt"
+	FailureBudget       = "budget_exceeded"
+)
+
+// failureReason derives the reason of the failure from the error
+// returned by the fire and the trace of what happened
+func failureReason(trace *fireTrace, err error) string {
+	var validationErr *ArgsValidationError
+
+	switch {
+	case trace != nil && trace.failure != "":
+		return trace.failure
+	case errors.Is(err, ErrMachineClosed):
+		return FailureClosed
+	case errors.Is(err, ErrStaleVersion):
+		return FailureStaleVersion
+	case errors.Is(err, ErrRateLimited):
+		return FailureRateLimited
+	case errors.Is(err, ErrTransitionBudgetExceeded):
+		return FailureBudget
+	case errors.Is(err, ErrEventNotFound), errors.As(err, &validationErr):
+		return FailureInvalidInput
+	case errors.Is(err, ErrEventDisabled), errors.Is(err, ErrFeatureOff):
+		return FailureUnauthorized
+	case errors.Is(err, ErrLockTimeout), errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return FailureTimeout
+	case errors.Is(err, ErrNoHandler):
+		return FailureNoHandler
+	case trace != nil && trace.rejected:
+		return FailureGuard
+	case trace != nil && trace.committed:
+		return FailureAfterError
+	default:
+		return FailureOnError
+	}
+}
+
+// countFailure reports a fire that failed before it was executed
+func (sm *StateMachine) countFailure(event string, err error) {
+	if sm.metrics != nil {
+		sm.notify(event, "Metrics", func() {
+			sm.metrics.TransitionFailed(event, failureReason(nil, err))
+		})
+	}
+}
+
+// LatencyRecorder records how long On takes
+type LatencyRecorder interface {
+	ObserveOnDuration(event string, d time.Duration)
+}
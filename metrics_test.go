@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"fsm/statsd"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStatsD records the metrics sent to StatsD
+type fakeStatsD struct {
+	metrics []string
+}
+
+func (s *fakeStatsD) Incr(name string, tags []string, rate float64) error {
+	s.metrics = append(s.metrics, fmt.Sprintf("incr %s %s", name, strings.Join(tags, ",")))
+	return nil
+}
+
+func (s *fakeStatsD) Timing(name string, value time.Duration, tags []string, rate float64) error {
+	s.metrics = append(s.metrics, fmt.Sprintf("timing %s %s %s", name, value, strings.Join(tags, ",")))
+	return nil
+}
+
+func TestStatsDMetrics(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+	clock := newFakeClock()
+	sink := &fakeStatsD{}
+
+	meta := map[string]string{"service": "transfers"}
+	metrics := statsd.New(sink, statsd.Options{Prefix: "payments", Tags: meta})
+
+	events := transferEvents(xfr)
+	events["authorize"].Transitions[0].On = func(args ...any) error {
+		clock.Advance(20 * time.Millisecond)
+		return nil
+	}
+
+	sm := NewStateMachine(Options{
+		CurrentState:    StatePending,
+		Clock:           clock,
+		Meta:            meta,
+		Metrics:         metrics,
+		LatencyRecorder: metrics,
+	})
+	sm.SetEvents(events)
+
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.Error(t, sm.Fire("authorize", 100))
+
+	require.Equal(t, []string{
+		"timing payments.on.duration 20ms service:transfers,event:authorize",
+		"incr payments.transition.authorize service:transfers,from:pending,to:authorized",
+		"incr payments.transition_failed.authorize service:transfers,reason:invalid_state",
+	}, sink.metrics)
+}
+
+// failureRecorder records the reasons of failed fires
+type failureRecorder struct {
+	reasons []string
+}
+
+func (r *failureRecorder) TransitionCompleted(event, from, to string) {}
+
+func (r *failureRecorder) TransitionFailed(event, reason string) {
+	r.reasons = append(r.reasons, event+":"+reason)
+}
+
+func TestMetricsFailureReasons(t *testing.T) {
+	metrics := &failureRecorder{}
+	repo := newFakeRepository(map[string]State{"xfr": StatePending})
+
+	events := transferEvents(&Transfer{})
+	events["capture"].Transitions[0].On = func(args ...any) error {
+		return fmt.Errorf("gateway error")
+	}
+	events["refund"] = Event{
+		Disabled:    true,
+		Transitions: []Transition{{From: StateAuthorized, To: StateVoided}},
+	}
+	void := events["void"]
+	void.ArgsSchema = ArgsSchema{{Name: "amount", Type: "int", Required: true}}
+	events["void"] = void
+
+	sm := NewStateMachine(Options{
+		Repository:   repo,
+		SubjectID:    "xfr",
+		Metrics:      metrics,
+		EventLimiter: NewEventLimiter(map[string]int{"capture": 0}),
+	})
+	sm.SetEvents(events)
+
+	require.NoError(t, sm.Fire("authorize", 100))
+
+	require.Error(t, sm.Fire("void", 150))
+	require.Error(t, sm.Fire("authorize", 100))
+	require.Error(t, sm.Fire("settle"))
+	require.Error(t, sm.FireValidated("void", map[string]any{}))
+	require.Error(t, sm.Fire("refund"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	require.Error(t, sm.FireContext(ctx, "capture"))
+
+	sm.limiter = nil
+	require.Error(t, sm.Fire("capture"))
+
+	repo.saveErr = fmt.Errorf("connection lost")
+	require.Error(t, sm.Fire("void", 50))
+
+	require.Equal(t, []string{
+		"void:guard",
+		"authorize:invalid_state",
+		"settle:invalid_input",
+		"void:invalid_input",
+		"refund:unauthorized",
+		"capture:timeout",
+		"capture:on_error",
+		"void:persistence",
+	}, metrics.reasons)
+
+	t.Run("no handler and lock errors", func(t *testing.T) {
+		metrics := &failureRecorder{}
+
+		sm := NewStateMachine(Options{
+			CurrentState:     StateAuthorized,
+			Metrics:          metrics,
+			RequireOnHandler: true,
+		})
+		sm.SetEvents(transferEvents(&Transfer{}))
+
+		require.ErrorIs(t, sm.Fire("capture"), ErrNoHandler)
+
+		sm.locker = brokenLocker{}
+		require.Error(t, sm.Fire("capture"))
+
+		require.Equal(t, []string{
+			"capture:no_handler",
+			"capture:lock_error",
+		}, metrics.reasons)
+	})
+}
+
+// brokenLocker is a SubjectLocker that fails to lock
+type brokenLocker struct{}
+
+func (brokenLocker) TryLock(ctx context.Context, id string) (func(), bool, error) {
+	return nil, false, fmt.Errorf("lock server unavailable")
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+var ErrAfterNotFound = fmt.Errorf("after not found")
+
+// OutboxEntry is a pending call of After of a committed transition
+type OutboxEntry struct {
+	ID    string
+	Event string
+	From  State
+	To    State
+	Args  []any
+
+	// Attempts is the number of failed calls of After and LastError the
+	// error of the last one
+	Attempts  int
+	LastError string
+}
+
+// OutboxStore keeps the entries of an Outbox until After succeeds.
+// Entries are added in the transaction of the fire, see
+// Repository.WithTx, so a store writing to the database of the
+// repository, e.g. with SQLTx, commits them with the new state and a
+// new Outbox delivers the entries left over by a crashed process.
+// Entries of transactions that fail to commit are removed.
+type OutboxStore interface {
+	Add(ctx context.Context, entry OutboxEntry) error
+	Update(ctx context.Context, entry OutboxEntry) error
+	Remove(ctx context.Context, id string) error
+
+	// List returns the entries, oldest first
+	List(ctx context.Context) ([]OutboxEntry, error)
+}
+
+// MemoryOutboxStore keeps the entries in memory
+type MemoryOutboxStore struct {
+	mu      sync.Mutex
+	entries []OutboxEntry
+}
+
+func NewMemoryOutboxStore() *MemoryOutboxStore {
+	return &MemoryOutboxStore{}
+}
+
+func (s *MemoryOutboxStore) Add(ctx context.Context, entry OutboxEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = append(s.entries, entry)
+
+	return nil
+}
+
+func (s *MemoryOutboxStore) Update(ctx context.Context, entry OutboxEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.entries {
+		if s.entries[i].ID == entry.ID {
+			s.entries[i] = entry
+			return nil
+		}
+	}
+
+	return fmt.Errorf("outbox entry %s not found", entry.ID)
+}
+
+func (s *MemoryOutboxStore) Remove(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.entries {
+		if s.entries[i].ID == id {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryOutboxStore) List(ctx context.Context) ([]OutboxEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]OutboxEntry, len(s.entries))
+	copy(entries, s.entries)
+
+	return entries, nil
+}
+
+// OutboxOptions configures an Outbox
+type OutboxOptions struct {
+	Machine *StateMachine
+
+	// Store keeps the entries, in memory by default
+	Store OutboxStore
+
+	// Retry defines how many times After is called for an entry and
+	// how long to wait between the calls. Without it, After is called
+	// once.
+	Retry *RetryPolicy
+
+	// ErrorHandler is called with the entries After failed for on the
+	// last attempt, e.g. to move them to a dead letter queue. They are
+	// removed from the store.
+	ErrorHandler func(entry OutboxEntry, err error)
+}
+
+// Outbox calls After of the transitions of a machine asynchronously,
+// so Fire returns once the transition is committed, regardless of the
+// delivery of the notifications After sends. Fire adds an entry to the
+// store for every transition with After, in the transaction saving the
+// new state, and a worker goroutine calls After for the entries in
+// order, retrying them according to the retry policy. Edge handlers
+// are still called by Fire.
+//
+// After is looked up by the event, the from and the to state of the
+// entry, so the events of the machine must not change while the
+// entries are pending.
+type Outbox struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	sm           *StateMachine
+	store        OutboxStore
+	retry        RetryPolicy
+	errorHandler func(entry OutboxEntry, err error)
+
+	// queue are the entries waiting to be delivered
+	queue []OutboxEntry
+
+	// pending counts the entries that are neither delivered nor
+	// failed. idle is closed when it drops to zero.
+	pending int
+	idle    chan struct{}
+
+	// stop is closed by Close to stop the worker, which closes done
+	// once it has stopped
+	closed bool
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewOutbox returns an outbox calling After of the transitions of the
+// machine and starts its worker. The entries already in the store are
+// delivered first.
+func NewOutbox(opts OutboxOptions) (*Outbox, error) {
+	store := opts.Store
+	if store == nil {
+		store = NewMemoryOutboxStore()
+	}
+
+	retry := RetryPolicy{MaxAttempts: 1}
+	if opts.Retry != nil && opts.Retry.MaxAttempts > 1 {
+		retry = *opts.Retry
+	}
+
+	o := &Outbox{
+		sm:           opts.Machine,
+		store:        store,
+		retry:        retry,
+		errorHandler: opts.ErrorHandler,
+		idle:         make(chan struct{}),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	o.cond = sync.NewCond(&o.mu)
+
+	entries, err := store.List(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("listing outbox entries: %w", err)
+	}
+
+	for _, entry := range entries {
+		o.push(entry)
+	}
+
+	o.sm.mu.Lock()
+	o.sm.outbox = o
+	o.sm.mu.Unlock()
+
+	go o.work()
+
+	return o, nil
+}
+
+// Drain waits until After is called successfully for all entries or
+// they failed on the last attempt. It returns the error of the context
+// if it's done first.
+func (o *Outbox) Drain(ctx context.Context) error {
+	o.mu.Lock()
+	if o.pending == 0 {
+		o.mu.Unlock()
+		return nil
+	}
+	idle := o.idle
+	o.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close detaches the outbox from the machine, so Fire calls After
+// again, drains it and stops the worker. The entries left when the
+// context is done stay in the store.
+func (o *Outbox) Close(ctx context.Context) error {
+	o.sm.mu.Lock()
+	if o.sm.outbox == o {
+		o.sm.outbox = nil
+	}
+	o.sm.mu.Unlock()
+
+	err := o.Drain(ctx)
+
+	o.mu.Lock()
+	if !o.closed {
+		o.closed = true
+		close(o.stop)
+		o.cond.Broadcast()
+	}
+	o.mu.Unlock()
+
+	select {
+	case <-o.done:
+	case <-ctx.Done():
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+
+	return err
+}
+
+// stageAfter adds the outbox entry for After of the pending
+// transition in the transaction of the fire, so it's committed with
+// the new state. Transitions that didn't change the subject don't call
+// After, and replayed ones called it already. The caller must hold the
+// lock.
+func (sm *StateMachine) stageAfter(ctx context.Context, pending *pendingTransition) error {
+	if sm.outbox == nil || pending.transition.After == nil || !pending.changed || IsReplay(ctx) {
+		return nil
+	}
+
+	entry := OutboxEntry{
+		ID:    randomID(),
+		Event: pending.name,
+		From:  pending.from,
+		To:    pending.transition.To,
+		Args:  pending.args,
+	}
+
+	if err := sm.outbox.store.Add(ctx, entry); err != nil {
+		return fmt.Errorf("adding outbox entry: %w", err)
+	}
+
+	pending.entry = &entry
+
+	return nil
+}
+
+// unstageAfter removes the outbox entry of a transition whose
+// transaction failed to commit. It was rolled back already by stores
+// that are part of the transaction. The caller must hold the lock.
+func (sm *StateMachine) unstageAfter(ctx context.Context, pending *pendingTransition) {
+	if pending.entry == nil {
+		return
+	}
+
+	_ = sm.outbox.store.Remove(ctx, pending.entry.ID)
+	pending.entry = nil
+}
+
+// push queues the entry for delivery
+func (o *Outbox) push(entry OutboxEntry) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.pending == 0 {
+		o.idle = make(chan struct{})
+	}
+	o.pending++
+
+	o.queue = append(o.queue, entry)
+	o.cond.Signal()
+}
+
+// work delivers the queued entries until the outbox is closed
+func (o *Outbox) work() {
+	defer close(o.done)
+
+	for {
+		o.mu.Lock()
+		for len(o.queue) == 0 && !o.closed {
+			o.cond.Wait()
+		}
+		if o.closed {
+			o.mu.Unlock()
+			return
+		}
+
+		entry := o.queue[0]
+		o.queue = o.queue[1:]
+		o.mu.Unlock()
+
+		o.deliver(entry)
+	}
+}
+
+// deliver calls After of the entry until it succeeds or the attempts
+// are exhausted, then it's handed to the error handler. The next
+// entries wait, so After is called in the order of the transitions.
+func (o *Outbox) deliver(entry OutboxEntry) {
+	ctx := context.Background()
+
+	for {
+		err := o.callAfter(entry)
+		if err == nil {
+			// the entry would be delivered again only if a new outbox
+			// started before it's removed
+			_ = o.store.Remove(ctx, entry.ID)
+			o.finish()
+			return
+		}
+
+		entry.Attempts++
+		entry.LastError = err.Error()
+
+		if entry.Attempts >= o.retry.MaxAttempts {
+			_ = o.store.Remove(ctx, entry.ID)
+			if o.errorHandler != nil {
+				o.errorHandler(entry, err)
+			}
+			o.finish()
+			return
+		}
+
+		_ = o.store.Update(ctx, entry)
+
+		wait := make(chan struct{})
+		timer := o.sm.clock.AfterFunc(o.retry.Backoff, func() { close(wait) })
+
+		select {
+		case <-wait:
+		case <-o.stop:
+			// the entry stays in the store
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// finish marks an entry as delivered or failed
+func (o *Outbox) finish() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.pending--
+	if o.pending == 0 {
+		close(o.idle)
+	}
+}
+
+// callAfter looks up After of the entry and calls it without holding
+// the lock of the machine
+func (o *Outbox) callAfter(entry OutboxEntry) error {
+	sm := o.sm
+
+	sm.mu.Lock()
+	after := sm.afterOf(entry.Event, entry.From, entry.To)
+	sm.mu.Unlock()
+
+	if after == nil {
+		return fmt.Errorf("event %s from %s to %s: %w", entry.Event, entry.From, entry.To, ErrAfterNotFound)
+	}
+
+	return sm.protect(entry.Event, "After", func() error {
+		return after(entry.Args...)
+	})
+}
+
+// afterOf returns After, or AfterContext, of the first transition of
+// the event from the state to the state that has one. The caller must
+// hold the lock.
+func (sm *StateMachine) afterOf(event string, from, to State) func(args ...any) error {
+	for _, transition := range sm.events[event].Transitions {
+		if transition.To != to || !sm.matchesFrom(from, transition.From) {
+			continue
+		}
+
+		if afterContext := transition.AfterContext; afterContext != nil {
+			return func(args ...any) error {
+				return afterContext(context.Background(), args...)
+			}
+		}
+
+		if transition.After != nil {
+			return transition.After
+		}
+	}
+
+	return nil
+}
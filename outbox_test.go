@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// publisher records the events published by After and fails the first
+// calls
+type publisher struct {
+	mu        sync.Mutex
+	failures  int
+	published []string
+	calls     int
+}
+
+func (p *publisher) after(event string) func(args ...any) error {
+	return func(args ...any) error {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		p.calls++
+		if p.calls <= p.failures {
+			return fmt.Errorf("broker unavailable")
+		}
+
+		p.published = append(p.published, fmt.Sprint(event, args))
+
+		return nil
+	}
+}
+
+func outboxMachine(p *publisher) *StateMachine {
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(map[string]Event{
+		"authorize": {
+			Transitions: []Transition{{
+				From:  StatePending,
+				To:    StateAuthorized,
+				After: p.after("authorize"),
+			}},
+		},
+		"capture": {
+			Transitions: []Transition{{
+				From:  StateAuthorized,
+				To:    StateCaptured,
+				After: p.after("capture"),
+			}},
+		},
+	})
+
+	return sm
+}
+
+func TestOutbox(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p := &publisher{failures: 2}
+	sm := outboxMachine(p)
+	store := NewMemoryOutboxStore()
+
+	outbox, err := NewOutbox(OutboxOptions{
+		Machine: sm,
+		Store:   store,
+		Retry:   &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond},
+	})
+	require.NoError(t, err)
+
+	// the failures of After don't fail the fires
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.NoError(t, sm.Fire("capture"))
+	require.Equal(t, StateCaptured, sm.State())
+
+	require.NoError(t, outbox.Drain(ctx))
+
+	p.mu.Lock()
+	require.Equal(t, []string{"authorize[100]", "capture[]"}, p.published)
+	require.Equal(t, 4, p.calls)
+	p.mu.Unlock()
+
+	entries, err := store.List(ctx)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	require.NoError(t, outbox.Close(ctx))
+
+	t.Run("closed", func(t *testing.T) {
+		p := &publisher{failures: 1}
+		sm := outboxMachine(p)
+
+		outbox, err := NewOutbox(OutboxOptions{Machine: sm})
+		require.NoError(t, err)
+		require.NoError(t, outbox.Close(ctx))
+
+		// After is called by Fire again
+		require.ErrorContains(t, sm.Fire("authorize"), "broker unavailable")
+	})
+}
+
+func TestOutboxFailure(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p := &publisher{failures: 10}
+	sm := outboxMachine(p)
+
+	var failed []OutboxEntry
+
+	outbox, err := NewOutbox(OutboxOptions{
+		Machine: sm,
+		Retry:   &RetryPolicy{MaxAttempts: 2},
+		ErrorHandler: func(entry OutboxEntry, err error) {
+			failed = append(failed, entry)
+		},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.NoError(t, outbox.Drain(ctx))
+
+	require.Len(t, failed, 1)
+	require.Equal(t, "authorize", failed[0].Event)
+	require.Equal(t, StatePending, failed[0].From)
+	require.Equal(t, StateAuthorized, failed[0].To)
+	require.Equal(t, 2, failed[0].Attempts)
+	require.Equal(t, "broker unavailable", failed[0].LastError)
+
+	require.NoError(t, outbox.Close(ctx))
+}
+
+func TestOutboxRecovery(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// left over by a crashed process
+	store := NewMemoryOutboxStore()
+	require.NoError(t, store.Add(ctx, OutboxEntry{
+		ID:    "1",
+		Event: "authorize",
+		From:  StatePending,
+		To:    StateAuthorized,
+		Args:  []any{100},
+	}))
+
+	p := &publisher{}
+
+	outbox, err := NewOutbox(OutboxOptions{
+		Machine: outboxMachine(p),
+		Store:   store,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, outbox.Close(ctx))
+	require.Equal(t, []string{"authorize[100]"}, p.published)
+
+	entries, err := store.List(ctx)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+// txOutboxStore is an OutboxStore recording whether entries are added
+// in a transaction of fakeRepository and failing to add them on demand
+type txOutboxStore struct {
+	*MemoryOutboxStore
+
+	inTx   []bool
+	addErr error
+}
+
+func (s *txOutboxStore) Add(ctx context.Context, entry OutboxEntry) error {
+	_, inTx := ctx.Value(fakeTxKey{}).(*fakeTx)
+	s.inTx = append(s.inTx, inTx)
+
+	if s.addErr != nil {
+		return s.addErr
+	}
+
+	return s.MemoryOutboxStore.Add(ctx, entry)
+}
+
+func TestOutboxTransactional(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p := &publisher{}
+	repo := newFakeRepository(map[string]State{"xfr": StatePending})
+	store := &txOutboxStore{MemoryOutboxStore: NewMemoryOutboxStore()}
+
+	sm := NewStateMachine(Options{
+		Repository: repo,
+		SubjectID:  "xfr",
+	})
+	sm.SetEvents(outboxMachine(p).events)
+
+	outbox, err := NewOutbox(OutboxOptions{Machine: sm, Store: store})
+	require.NoError(t, err)
+	defer outbox.Close(ctx)
+
+	// the entry can't be added, so the transition is rolled back
+	store.addErr = fmt.Errorf("store unavailable")
+	require.ErrorContains(t, sm.Fire("authorize", 100), "adding outbox entry")
+	require.Equal(t, StatePending, repo.states["xfr"])
+
+	// the transition can't be committed, so the entry is removed
+	store.addErr = nil
+	repo.commitErr = fmt.Errorf("serialization failure")
+	require.Error(t, sm.Fire("authorize", 100))
+
+	entries, err := store.List(ctx)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	repo.commitErr = nil
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.NoError(t, outbox.Drain(ctx))
+
+	require.Equal(t, []bool{true, true, true}, store.inTx)
+	require.Equal(t, []string{"authorize[100]"}, p.published)
+}
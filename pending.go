@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+var ErrPendingDone = fmt.Errorf("pending transition already committed or rolled back")
+
+var ErrPendingStale = fmt.Errorf("state changed since the transition began")
+
+var ErrPendingDelegated = fmt.Errorf("event is handled by a sub-machine")
+
+var ErrNotStageable = fmt.Errorf("transition is not stageable")
+
+// PendingTransition is a transition begun by Begin that is not
+// committed yet
+type PendingTransition struct {
+	sm      *StateMachine
+	pending *pendingTransition
+	staged  any
+	done    bool
+}
+
+// Begin starts the transition of the event without committing it, for
+// operations the caller confirms in several stages. The transition is
+// checked and OnContext is run as by Fire, but against a copy of the
+// subject, see SubjectOf, which must be a pointer implementing Cloner
+// if it's set. The state and the subject of the machine only change
+// when the returned transition is committed. On can't be pointed at
+// the copy, so a transition with On but no OnContext fails with
+// ErrNotStageable, as do events delegated to sub-machines with
+// ErrPendingDelegated. Errors are passed to the ErrorHandler as by
+// Fire, but are returned even if it swallows them, as there is no
+// transition to return.
+func (sm *StateMachine) Begin(name string, args ...any) (*PendingTransition, error) {
+	sm.lockFire()
+	defer sm.unlockFire()
+
+	// the staged copy replaces the subject it points to at Commit
+	var staged any
+	if cloner, ok := sm.subject.(Cloner); ok && reflect.TypeOf(sm.subject).Kind() == reflect.Pointer {
+		staged = cloner.Clone()
+	}
+	if sm.subject != nil && reflect.TypeOf(staged) != reflect.TypeOf(sm.subject) {
+		return nil, sm.beginFailed(name, ErrSubjectNotCloneable)
+	}
+
+	ctx := withSubject(context.Background(), staged)
+	trace := &fireTrace{staged: true}
+
+	var pending *pendingTransition
+
+	err := sm.traced(ctx, trace, name, args, func() error {
+		if err := sm.admit(ctx, name); err != nil {
+			return err
+		}
+
+		var err error
+		pending, err = sm.prepare(ctx, trace, name, args)
+		if err != nil {
+			return err
+		}
+
+		// the state changes at Commit
+		sm.currentState = pending.from
+
+		if pending.sub != nil {
+			return fmt.Errorf("event %s: delegated to the sub-machine of %s: %w", name, pending.from, ErrPendingDelegated)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, sm.beginFailed(name, err)
+	}
+
+	return &PendingTransition{
+		sm:      sm,
+		pending: pending,
+		staged:  staged,
+	}, nil
+}
+
+// beginFailed passes the error of Begin to the error handler. The error
+// is returned if the handler swallows it.
+func (sm *StateMachine) beginFailed(name string, err error) error {
+	if handled := sm.handleError(name, err); handled != nil {
+		return handled
+	}
+
+	return err
+}
+
+// To returns the state the transition leads to
+func (p *PendingTransition) To() State {
+	return p.pending.transition.To
+}
+
+// Staged returns the copy of the subject On updated, or nil if the
+// machine has no subject
+func (p *PendingTransition) Staged() any {
+	return p.staged
+}
+
+// Commit commits the transition: the new state is saved, the subject
+// is replaced by the staged copy and After is called, as by Fire. It
+// returns ErrPendingStale if the state changed since Begin.
+func (p *PendingTransition) Commit() error {
+	sm, pending := p.sm, p.pending
+
+	sm.lockFire()
+	defer sm.unlockFire()
+
+	if p.done {
+		return ErrPendingDone
+	}
+	p.done = true
+
+	ctx := context.Background()
+	trace := &fireTrace{from: pending.from, transition: &pending.transition, started: true}
+
+	err := sm.traced(ctx, trace, pending.name, pending.args, func() error {
+		if err := sm.admit(ctx, pending.name); err != nil {
+			return err
+		}
+
+		saved := false
+
+		err := sm.withTx(ctx, func(ctx context.Context) error {
+			current, err := sm.lockState(ctx)
+			if err != nil {
+				trace.failure = FailurePersistence
+				return fmt.Errorf("loading state: %w", err)
+			}
+
+			if current != pending.from {
+				return fmt.Errorf("event %s: began in %s, now in %s: %w", pending.name, pending.from, current, ErrPendingStale)
+			}
+
+			sm.currentState = pending.transition.To
+
+			if err := sm.save(ctx, trace, pending); err != nil {
+				return err
+			}
+
+			saved = true
+			return nil
+		})
+		if err != nil {
+			if saved {
+				return sm.rollback(ctx, trace, pending, err)
+			}
+			return err
+		}
+
+		sm.cacheState(pending.transition.To)
+
+		if p.staged != nil {
+			reflect.ValueOf(sm.subject).Elem().Set(reflect.ValueOf(p.staged).Elem())
+		}
+
+		return sm.commit(ctx, trace, pending)
+	})
+
+	return sm.handleError(pending.name, err)
+}
+
+// Rollback discards the transition. The state and the subject are left
+// unchanged, but what On did outside of the machine is not undone.
+func (p *PendingTransition) Rollback() error {
+	p.sm.mu.Lock()
+	defer p.sm.mu.Unlock()
+
+	if p.done {
+		return ErrPendingDone
+	}
+	p.done = true
+
+	return nil
+}
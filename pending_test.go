@@ -0,0 +1,147 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBeginCommit(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		Subject:      xfr,
+	})
+	sm.SetEvents(transferSubjectEvents(xfr))
+
+	pending, err := sm.Begin("authorize", 100)
+	require.NoError(t, err)
+	require.Equal(t, StateAuthorized, pending.To())
+	require.Equal(t, 100, pending.Staged().(*Transfer).AuthorizedAmount)
+
+	// nothing is visible until the transition is committed
+	require.Equal(t, StatePending, sm.State())
+	require.Zero(t, xfr.AuthorizedAmount)
+	require.Empty(t, sm.History())
+
+	require.NoError(t, pending.Commit())
+
+	require.Equal(t, StateAuthorized, sm.State())
+	require.Equal(t, 100, xfr.AuthorizedAmount)
+	require.Len(t, sm.History(), 1)
+
+	require.ErrorIs(t, pending.Commit(), ErrPendingDone)
+}
+
+func TestBeginRollback(t *testing.T) {
+	xfr := &Transfer{ID: "xfr", AuthorizedAmount: 100}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StateAuthorized,
+		Subject:      xfr,
+	})
+	sm.SetEvents(transferSubjectEvents(xfr))
+
+	pending, err := sm.Begin("void", 40)
+	require.NoError(t, err)
+
+	require.NoError(t, pending.Rollback())
+	require.ErrorIs(t, pending.Commit(), ErrPendingDone)
+
+	require.Equal(t, StateAuthorized, sm.State())
+	require.Equal(t, 100, xfr.AuthorizedAmount)
+	require.Zero(t, xfr.VoidedAmount)
+}
+
+func TestBeginStale(t *testing.T) {
+	xfr := &Transfer{ID: "xfr", AuthorizedAmount: 100}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StateAuthorized,
+		Subject:      xfr,
+	})
+	sm.SetEvents(transferSubjectEvents(xfr))
+
+	pending, err := sm.Begin("capture")
+	require.NoError(t, err)
+
+	require.NoError(t, sm.Fire("void"))
+
+	require.ErrorIs(t, pending.Commit(), ErrPendingStale)
+	require.Equal(t, StateVoided, sm.State())
+}
+
+func TestBeginChecks(t *testing.T) {
+	t.Run("require on handler", func(t *testing.T) {
+		xfr := &Transfer{ID: "xfr", AuthorizedAmount: 100}
+
+		sm := NewStateMachine(Options{
+			CurrentState:     StateAuthorized,
+			Subject:          xfr,
+			RequireOnHandler: true,
+		})
+		sm.SetEvents(transferEvents(xfr))
+
+		_, err := sm.Begin("capture")
+		require.ErrorIs(t, err, ErrNoHandler)
+		require.Equal(t, StateAuthorized, sm.State())
+	})
+
+	t.Run("plain on handler", func(t *testing.T) {
+		xfr := &Transfer{ID: "xfr"}
+
+		var handled []error
+
+		sm := NewStateMachine(Options{
+			CurrentState: StatePending,
+			Subject:      xfr,
+			ErrorHandler: func(event string, err error) error {
+				handled = append(handled, err)
+				return err
+			},
+		})
+		sm.SetEvents(transferEvents(xfr))
+
+		_, err := sm.Begin("authorize", 100)
+		require.ErrorIs(t, err, ErrNotStageable)
+		require.Equal(t, []error{err}, handled)
+
+		// On didn't run against the subject
+		require.Zero(t, xfr.AuthorizedAmount)
+		require.Equal(t, StatePending, sm.State())
+	})
+
+	t.Run("transition budget", func(t *testing.T) {
+		xfr := &Transfer{ID: "xfr"}
+
+		sm := NewStateMachine(Options{
+			CurrentState:   StatePending,
+			Subject:        xfr,
+			MaxTransitions: 1,
+		})
+		sm.SetEvents(transferSubjectEvents(xfr))
+
+		require.NoError(t, sm.Fire("authorize", 100))
+
+		_, err := sm.Begin("capture")
+		require.ErrorIs(t, err, ErrTransitionBudgetExceeded)
+	})
+
+	t.Run("diff of the staged subject", func(t *testing.T) {
+		xfr := &Transfer{ID: "xfr"}
+
+		sm := NewStateMachine(Options{
+			CurrentState: StatePending,
+			Subject:      xfr,
+			DiffSubject:  true,
+		})
+		sm.SetEvents(transferSubjectEvents(xfr))
+
+		pending, err := sm.Begin("authorize", 100)
+		require.NoError(t, err)
+		require.NoError(t, pending.Commit())
+
+		require.Equal(t, SubjectDiff{{Field: "AuthorizedAmount", Before: 0, After: 100}}, sm.History()[0].Diff)
+	})
+}
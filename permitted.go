@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+var ErrEventDisabled = fmt.Errorf("event disabled")
+var ErrFeatureOff = fmt.Errorf("feature off")
+var ErrGuardRejected = fmt.Errorf("guard rejected")
+
+// reasons an event is not permitted
+const (
+	reasonNoMatchingFrom = "no matching from state"
+	reasonGuardRejected  = "guard rejected"
+	reasonDisabled       = "disabled"
+	reasonFeatureOff     = "feature off"
+	reasonGlobalGuard    = "global guard rejected"
+	reasonNotFound       = "event not found"
+)
+
+// rejection tells why gate didn't select a transition
+type rejection struct {
+	reason string
+
+	// err is the error returned by the global guard
+	err error
+}
+
+// gate selects the transition Fire executes for the event of the guard
+// context from its state. If the event is not permitted, it returns
+// the rejection instead. The global guard is evaluated before the
+// guards of the transitions. When the trace audits, the guards of all
+// transitions from the state are evaluated and recorded, while the
+// first allowed one is still selected.
+func (sm *StateMachine) gate(gc GuardContext, event Event, args []any, trace *fireTrace) (Transition, *rejection) {
+	if event.Disabled {
+		return Transition{}, &rejection{reason: reasonDisabled}
+	}
+
+	if event.Feature != "" && (sm.featureEnabled == nil || !sm.featureEnabled(event.Feature)) {
+		return Transition{}, &rejection{reason: reasonFeatureOff}
+	}
+
+	if sm.globalGuard != nil {
+		var allowed bool
+		err := sm.protect(gc.event, "GlobalGuard", func() error {
+			var err error
+			allowed, err = sm.globalGuard(gc, args...)
+			return err
+		})
+		if err != nil {
+			return Transition{}, &rejection{reason: reasonGlobalGuard + ": " + err.Error(), err: err}
+		}
+		if !allowed {
+			return Transition{}, &rejection{reason: reasonGlobalGuard}
+		}
+	}
+
+	reason := reasonNoMatchingFrom
+
+	var selected *Transition
+
+	for i, transition := range event.Transitions {
+		if !sm.matchesFrom(gc.from, transition.From) {
+			continue
+		}
+
+		allowed := sm.guardAllows(gc, transition, args)
+
+		if trace != nil && trace.audit && transition.guarded() {
+			trace.guards = append(trace.guards, guardEvaluation{
+				transition: transition,
+				allowed:    allowed,
+			})
+		}
+
+		if !allowed {
+			reason = reasonGuardRejected
+			continue
+		}
+
+		if selected == nil {
+			selected = &event.Transitions[i]
+		}
+
+		if trace == nil || !trace.audit {
+			break
+		}
+	}
+
+	if selected == nil {
+		return Transition{}, &rejection{reason: reason}
+	}
+
+	return *selected, nil
+}
+
+// gateError converts the rejection returned by gate into the error
+// returned by Fire
+func gateError(name string, r *rejection) error {
+	if r.err != nil {
+		return fmt.Errorf("event %s: %w", name, r.err)
+	}
+
+	switch r.reason {
+	case reasonGlobalGuard:
+		return fmt.Errorf("event %s: %w", name, ErrGuardRejected)
+	case reasonDisabled:
+		return fmt.Errorf("event %s: %w", name, ErrEventDisabled)
+	case reasonFeatureOff:
+		return fmt.Errorf("event %s: %w", name, ErrFeatureOff)
+	default:
+		return fmt.Errorf("event %s: %w", name, ErrNoTransitionForEvent)
+	}
+}
+
+// PermittedEventsExplained returns, for every event, an empty string
+// if the event is permitted from the current state with the args, or
+// the reason it's excluded otherwise. Events delegated to the
+// sub-machine of the state are explained by the sub-machine, as by
+// CanFire.
+func (sm *StateMachine) PermittedEventsExplained(args ...any) map[string]string {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	current, err := sm.loadState(context.Background())
+	if err != nil {
+		current = sm.currentState
+	}
+
+	var delegated map[string]string
+	if sub, ok := sm.subMachines[current]; ok {
+		delegated = sub.Machine.PermittedEventsExplained(args...)
+	}
+
+	explained := make(map[string]string, len(sm.events))
+	for name, event := range sm.events {
+		if delegated != nil && !sm.handles(name, current) {
+			reason, ok := delegated[name]
+			if !ok {
+				reason = reasonNotFound
+			}
+			explained[name] = reason
+			continue
+		}
+
+		_, rejected := sm.gate(sm.guardContext(context.Background(), name, current), event, args, nil)
+		if rejected != nil {
+			explained[name] = rejected.reason
+		} else {
+			explained[name] = ""
+		}
+	}
+
+	return explained
+}
+
+// CanFire returns true if firing the event with the args from the
+// current state would select a transition. The event must exist, a
+// transition must be from the current state and its guards must allow
+// it, exactly as evaluated by Fire. Neither On nor After is called and
+// the state doesn't change, but the guards are, so they must be free of
+// side effects.
+func (sm *StateMachine) CanFire(name string, args ...any) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	current, err := sm.loadState(context.Background())
+	if err != nil {
+		current = sm.currentState
+	}
+
+	return sm.canFire(current, name, args)
+}
+
+// PermittedEvents returns the sorted names of the events CanFire
+// returns true for with the args
+func (sm *StateMachine) PermittedEvents(args ...any) []string {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	current, err := sm.loadState(context.Background())
+	if err != nil {
+		current = sm.currentState
+	}
+
+	var permitted []string
+	for _, name := range sm.eventNames {
+		if sm.canFire(current, name, args) {
+			permitted = append(permitted, name)
+		}
+	}
+
+	return permitted
+}
+
+// AvailableEvents returns the sorted names of the events that have a
+// transition from the current state and are neither disabled nor
+// behind a disabled feature, e.g. the actions offered for a transfer.
+// Unlike PermittedEvents, the guards are not evaluated, as they
+// usually depend on args the caller doesn't have yet, like the amount
+// to void.
+func (sm *StateMachine) AvailableEvents() []string {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	current, err := sm.loadState(context.Background())
+	if err != nil {
+		current = sm.currentState
+	}
+
+	return sm.availableEvents(current)
+}
+
+// availableEvents returns the names of the events available from the
+// state, including the ones delegated to its sub-machine. The caller
+// must hold the lock.
+func (sm *StateMachine) availableEvents(current State) []string {
+	var available []string
+
+	for _, name := range sm.eventNames {
+		event := sm.events[name]
+
+		if event.Disabled || (event.Feature != "" && (sm.featureEnabled == nil || !sm.featureEnabled(event.Feature))) {
+			continue
+		}
+
+		for _, transition := range event.Transitions {
+			if sm.matchesFrom(current, transition.From) {
+				available = append(available, name)
+				break
+			}
+		}
+	}
+
+	if sub, ok := sm.subMachines[current]; ok {
+		for _, name := range sub.Machine.AvailableEvents() {
+			if !sm.handles(name, current) {
+				available = append(available, name)
+			}
+		}
+		sort.Strings(available)
+	}
+
+	return available
+}
+
+// canFire returns true if gate selects a transition of the event from
+// the state. Events the machine doesn't handle in a state with a
+// sub-machine are checked against the sub-machine, as Fire delegates
+// them. The caller must hold the lock.
+func (sm *StateMachine) canFire(current State, name string, args []any) bool {
+	if sub, ok := sm.subMachines[current]; ok && !sm.handles(name, current) {
+		return sub.Machine.CanFire(name, args...)
+	}
+
+	event, ok := sm.events[name]
+	if !ok {
+		return false
+	}
+
+	_, rejected := sm.gate(sm.guardContext(context.Background(), name, current), event, args, nil)
+
+	return rejected == nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermittedEventsExplained(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	events := transferEvents(xfr)
+	events["refund"] = Event{
+		Feature:     "refunds",
+		Transitions: []Transition{{From: StateAuthorized, To: StateVoided}},
+	}
+	events["reverse"] = Event{
+		Disabled:    true,
+		Transitions: []Transition{{From: StateAuthorized, To: StateVoided}},
+	}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(events)
+
+	err := sm.Fire("authorize", 100)
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]string{
+		"authorize": "no matching from state",
+		"capture":   "",
+		"void":      "",
+		"refund":    "feature off",
+		"reverse":   "disabled",
+	}, sm.PermittedEventsExplained(50))
+
+	require.Equal(t, "guard rejected", sm.PermittedEventsExplained(150)["void"])
+
+	err = sm.Fire("refund")
+	require.True(t, errors.Is(err, ErrFeatureOff))
+
+	err = sm.Fire("reverse")
+	require.True(t, errors.Is(err, ErrEventDisabled))
+}
+
+func TestPermittedEventsExplainedSubMachine(t *testing.T) {
+	const (
+		stateReview   State = "review"
+		stateApproved State = "approved"
+	)
+
+	// authorize from review is delegated by the authorized parent
+	review := NewStateMachine(Options{CurrentState: stateReview})
+	review.SetEvents(map[string]Event{
+		"authorize": {
+			Transitions: []Transition{{From: stateReview, To: stateApproved}},
+		},
+	})
+
+	sm := NewStateMachine(Options{
+		CurrentState: StateAuthorized,
+		SubMachines: map[State]SubMachine{
+			StateAuthorized: {Machine: review},
+		},
+	})
+	sm.SetEvents(transferEvents(&Transfer{AuthorizedAmount: 100}))
+
+	require.Equal(t, map[string]string{
+		"authorize": "",
+		"capture":   "",
+		"void":      "",
+	}, sm.PermittedEventsExplained(50))
+	require.Equal(t, []string{"authorize", "capture", "void"}, sm.PermittedEvents(50))
+
+	require.NoError(t, review.Fire("authorize"))
+
+	require.Equal(t, "no matching from state", sm.PermittedEventsExplained(50)["authorize"])
+	require.Equal(t, []string{"capture", "void"}, sm.PermittedEvents(50))
+}
+
+func TestCanFire(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	var onCalls int
+
+	events := transferEvents(xfr)
+	authorize := events["authorize"].Transitions[0]
+	on := authorize.On
+	authorize.On = func(args ...any) error {
+		onCalls++
+		return on(args...)
+	}
+	events["authorize"] = Event{Transitions: []Transition{authorize}}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(events)
+
+	require.True(t, sm.CanFire("authorize", 100))
+	require.False(t, sm.CanFire("capture"))
+	require.False(t, sm.CanFire("refund"))
+	require.Equal(t, []string{"authorize"}, sm.PermittedEvents(100))
+
+	require.Zero(t, onCalls)
+	require.Equal(t, StatePending, sm.State())
+
+	require.NoError(t, sm.Fire("authorize", 100))
+
+	// voiding more than authorized is rejected by both guards
+	require.False(t, sm.CanFire("void", 150))
+	require.True(t, sm.CanFire("void", 50))
+	require.Equal(t, []string{"capture"}, sm.PermittedEvents(150))
+	require.Equal(t, []string{"capture", "void"}, sm.PermittedEvents(50))
+
+	require.NoError(t, sm.Fire("void", 50))
+	require.Equal(t, StatePartiallyAuthorized, sm.State())
+}
+
+func TestAvailableEvents(t *testing.T) {
+	events := transferEvents(&Transfer{})
+	events["refund"] = Event{
+		Disabled:    true,
+		Transitions: []Transition{{From: StateAuthorized, To: StateVoided}},
+	}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(events)
+
+	require.Equal(t, []string{"authorize"}, sm.AvailableEvents())
+
+	require.NoError(t, sm.Fire("authorize", 100))
+
+	// refund is disabled and void is available whatever its guards
+	// decide for the amount
+	require.False(t, sm.CanFire("void", 150))
+	require.Equal(t, []string{"capture", "void"}, sm.AvailableEvents())
+
+	require.NoError(t, sm.Fire("capture"))
+	require.Empty(t, sm.AvailableEvents())
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrSubjectNotCloneable = fmt.Errorf("subject is not cloneable")
+var ErrNotProjectable = fmt.Errorf("transition is not projectable")
+
+// Cloner is implemented by subjects that can be deep copied
+type Cloner interface {
+	Clone() any
+}
+
+// subjectKey is the context key of the subject updated by OnContext
+type subjectKey struct{}
+
+// projectionKey is the context key marking projections
+type projectionKey struct{}
+
+// SubjectOf returns the subject OnContext should update: the subject of
+// the machine, or its copy when the event is projected by Project or
+// DryRunSequence or begun by Begin. It's nil if the machine has no
+// subject.
+//
+//	OnContext: func(ctx context.Context, args ...any) error {
+//		SubjectOf(ctx).(*Transfer).AuthorizedAmount = args[0].(int)
+//		return nil
+//	},
+func SubjectOf(ctx context.Context) any {
+	return ctx.Value(subjectKey{})
+}
+
+// IsProjection returns true if the context is of a projection made by
+// Project or DryRunSequence. Handlers should skip their external
+// effects, as for replays, see IsReplay.
+func IsProjection(ctx context.Context) bool {
+	projection, _ := ctx.Value(projectionKey{}).(bool)
+	return projection
+}
+
+// withSubject returns the context carrying the subject for SubjectOf
+func withSubject(ctx context.Context, subject any) context.Context {
+	return context.WithValue(ctx, subjectKey{}, subject)
+}
+
+// Project returns what the subject and its state would be after firing
+// the event, without changing either. OnContext of the selected
+// transition is run against a deep copy of the subject, see SubjectOf
+// and IsProjection. After is not called. On can't be pointed at the
+// copy, so a transition with On but no OnContext fails with
+// ErrNotProjectable. The subject must implement Cloner.
+func (sm *StateMachine) Project(name string, args ...any) (projectedSubject any, to State, err error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	cloner, ok := sm.subject.(Cloner)
+	if !ok {
+		return nil, "", ErrSubjectNotCloneable
+	}
+
+	current, err := sm.loadState(context.Background())
+	if err != nil {
+		return nil, "", fmt.Errorf("loading state: %w", err)
+	}
+
+	projected := cloner.Clone()
+
+	to, err = sm.project(context.Background(), name, current, projected, args)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return projected, to, nil
+}
+
+// project selects the transition of the event from the state and runs
+// its OnContext against the copy of the subject. Guards see the copy as
+// the subject. It returns the state the transition leads to. The
+// caller must hold the lock.
+func (sm *StateMachine) project(ctx context.Context, name string, from State, projected any, args []any) (State, error) {
+	ctx = context.WithValue(withSubject(ctx, projected), projectionKey{}, true)
+
+	event, ok := sm.events[name]
+	if !ok {
+		return "", ErrEventNotFound
+	}
+
+	gc := sm.guardContext(ctx, name, from)
+	gc.subject = projected
+
+	transition, rejected := sm.gate(gc, event, args, nil)
+	if rejected != nil {
+		return "", gateError(name, rejected)
+	}
+
+	// skipping On would project a subject it never changed
+	if transition.On != nil && transition.OnContext == nil {
+		return "", fmt.Errorf("event %s from %s to %s: %w", name, from, transition.To, ErrNotProjectable)
+	}
+
+	if transition.OnContext != nil {
+		err := sm.protect(name, "On", func() error {
+			return transition.OnContext(ctx, args...)
+		})
+		if err != nil && !errors.Is(err, ErrNoChange) {
+			return "", fmt.Errorf("error during transition from %s to %s: %w", from, transition.To, err)
+		}
+	}
+
+	return transition.To, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProject(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		Subject:      xfr,
+	})
+	sm.SetEvents(transferSubjectEvents(xfr))
+
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.Equal(t, 100, xfr.AuthorizedAmount)
+
+	projected, to, err := sm.Project("void", 50)
+	require.NoError(t, err)
+	require.Equal(t, StatePartiallyAuthorized, to)
+	require.Equal(t, &Transfer{ID: "xfr", AuthorizedAmount: 50, VoidedAmount: 50}, projected)
+
+	// neither the subject nor the state changed
+	require.Equal(t, &Transfer{ID: "xfr", AuthorizedAmount: 100}, xfr)
+	require.Equal(t, StateAuthorized, sm.State())
+
+	_, _, err = sm.Project("void", 150)
+	require.ErrorIs(t, err, ErrNoTransitionForEvent)
+}
+
+func TestProjectRequiresCloneableSubject(t *testing.T) {
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		Subject:      struct{}{},
+	})
+
+	_, _, err := sm.Project("authorize", 100)
+	require.ErrorIs(t, err, ErrSubjectNotCloneable)
+}
+
+func TestProjectRequiresOnContext(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		Subject:      xfr,
+	})
+	sm.SetEvents(transferEvents(xfr))
+
+	_, _, err := sm.Project("authorize", 100)
+	require.ErrorIs(t, err, ErrNotProjectable)
+	require.Equal(t, &Transfer{ID: "xfr"}, xfr)
+}
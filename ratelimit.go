@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+var ErrRateLimited = fmt.Errorf("rate limited")
+
+// RateLimit limits how often a transition is taken per subject. Rate is
+// the number of transitions allowed per second and Burst is the number
+// of transitions that can be taken at once.
+type RateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// tokenBucket holds the tokens left for a transition of a subject
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take refills the bucket for the time elapsed since the last take and
+// takes a token if there is one
+func (b *tokenBucket) take(limit RateLimit, now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * limit.Rate
+	if b.tokens > float64(limit.Burst) {
+		b.tokens = float64(limit.Burst)
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+
+	return true
+}
+
+// allowRate takes a token from the bucket of the transition of the
+// subject. It returns ErrRateLimited when the bucket is empty. The
+// caller must hold the lock.
+func (sm *StateMachine) allowRate(name string, transition Transition) error {
+	if transition.RateLimit == nil {
+		return nil
+	}
+
+	key := sm.subjectID + "/" + handlerName(name, transition, "RateLimit")
+
+	now := sm.clock.Now()
+
+	bucket, ok := sm.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(transition.RateLimit.Burst), last: now}
+		sm.buckets[key] = bucket
+	}
+
+	if !bucket.take(*transition.RateLimit, now) {
+		return fmt.Errorf("event %s from %s to %s: %w", name, transition.From, transition.To, ErrRateLimited)
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimit(t *testing.T) {
+	clock := newFakeClock()
+
+	var voids int
+
+	sm := NewStateMachine(Options{
+		CurrentState: StateAuthorized,
+		SubjectID:    "xfr",
+		Clock:        clock,
+	})
+	sm.SetEvents(map[string]Event{
+		"void": {
+			Transitions: []Transition{{
+				From:      StateAuthorized,
+				To:        StateAuthorized,
+				RateLimit: &RateLimit{Rate: 1, Burst: 1},
+				On: func(args ...any) error {
+					voids++
+					return nil
+				},
+			}},
+		},
+	})
+
+	require.NoError(t, sm.Fire("void"))
+	require.ErrorIs(t, sm.Fire("void"), ErrRateLimited)
+	require.Equal(t, 1, voids)
+
+	clock.Advance(time.Second)
+
+	require.NoError(t, sm.Fire("void"))
+	require.Equal(t, 2, voids)
+}
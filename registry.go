@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+var ErrHandlerNotFound = fmt.Errorf("handler not found")
+
+// Registry maps names to guards and actions so the function fields
+// of transitions can be referenced by name in generated code and
+// definitions
+type Registry struct {
+	mu         sync.RWMutex
+	guards     map[string]func(args ...any) bool
+	ctxGuards  map[string]func(gc GuardContext, args ...any) bool
+	softGuards map[string]func(args ...any) (bool, string)
+	actions    map[string]func(args ...any) error
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		guards:     make(map[string]func(args ...any) bool),
+		ctxGuards:  make(map[string]func(gc GuardContext, args ...any) bool),
+		softGuards: make(map[string]func(args ...any) (bool, string)),
+		actions:    make(map[string]func(args ...any) error),
+	}
+}
+
+func (r *Registry) RegisterGuard(name string, guard func(args ...any) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.guards[name] = guard
+}
+
+func (r *Registry) RegisterContextGuard(name string, guard func(gc GuardContext, args ...any) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ctxGuards[name] = guard
+}
+
+func (r *Registry) RegisterSoftGuard(name string, guard func(args ...any) (bool, string)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.softGuards[name] = guard
+}
+
+// RegisterAction registers a function used as On or After
+func (r *Registry) RegisterAction(name string, action func(args ...any) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.actions[name] = action
+}
+
+// Guard returns a guard calling the guard registered under the name.
+// The guard is looked up when it's called, so it can be registered
+// later. A guard that is not registered rejects the transition.
+func (r *Registry) Guard(name string) func(args ...any) bool {
+	return func(args ...any) bool {
+		r.mu.RLock()
+		guard, ok := r.guards[name]
+		r.mu.RUnlock()
+
+		return ok && guard(args...)
+	}
+}
+
+// ContextGuard returns a context guard calling the context guard
+// registered under the name when it's called. A guard that is not
+// registered rejects the transition.
+func (r *Registry) ContextGuard(name string) func(gc GuardContext, args ...any) bool {
+	return func(gc GuardContext, args ...any) bool {
+		r.mu.RLock()
+		guard, ok := r.ctxGuards[name]
+		r.mu.RUnlock()
+
+		return ok && guard(gc, args...)
+	}
+}
+
+// SoftGuard returns a soft guard calling the soft guard registered
+// under the name when it's called
+func (r *Registry) SoftGuard(name string) func(args ...any) (bool, string) {
+	return func(args ...any) (bool, string) {
+		r.mu.RLock()
+		guard, ok := r.softGuards[name]
+		r.mu.RUnlock()
+
+		if !ok {
+			return true, fmt.Sprintf("soft guard %s: %s", name, ErrHandlerNotFound)
+		}
+
+		return guard(args...)
+	}
+}
+
+// Action returns a function calling the action registered under the
+// name when it's called. It returns ErrHandlerNotFound if no action
+// is registered.
+func (r *Registry) Action(name string) func(args ...any) error {
+	return func(args ...any) error {
+		r.mu.RLock()
+		action, ok := r.actions[name]
+		r.mu.RUnlock()
+
+		if !ok {
+			return fmt.Errorf("action %s: %w", name, ErrHandlerNotFound)
+		}
+
+		return action(args...)
+	}
+}
+
+// LookupGuard returns the guard registered under the name. Unlike
+// Guard, it's looked up immediately.
+func (r *Registry) LookupGuard(name string) (func(args ...any) bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	guard, ok := r.guards[name]
+	if !ok {
+		return nil, fmt.Errorf("guard %s: %w", name, ErrHandlerNotFound)
+	}
+
+	return guard, nil
+}
+
+// LookupContextGuard returns the context guard registered under the
+// name, e.g. a field guard registered by RegisterFieldGuards. Unlike
+// ContextGuard, it's looked up immediately.
+func (r *Registry) LookupContextGuard(name string) (func(gc GuardContext, args ...any) bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	guard, ok := r.ctxGuards[name]
+	if !ok {
+		return nil, fmt.Errorf("context guard %s: %w", name, ErrHandlerNotFound)
+	}
+
+	return guard, nil
+}
+
+// LookupAction returns the action registered under the name. Unlike
+// Action, it's looked up immediately.
+func (r *Registry) LookupAction(name string) (func(args ...any) error, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	action, ok := r.actions[name]
+	if !ok {
+		return nil, fmt.Errorf("action %s: %w", name, ErrHandlerNotFound)
+	}
+
+	return action, nil
+}
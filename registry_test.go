@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+
+	guard := registry.Guard("allowed")
+	action := registry.Action("authorize")
+
+	// handlers are looked up when they are called
+	require.False(t, guard())
+	require.ErrorIs(t, action(), ErrHandlerNotFound)
+
+	registry.RegisterGuard("allowed", func(args ...any) bool { return true })
+	registry.RegisterAction("authorize", func(args ...any) error { return nil })
+
+	require.True(t, guard())
+	require.NoError(t, action())
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+var ErrReplayDiverged = fmt.Errorf("replay diverged from history")
+
+// replayKey is the context key of the record being replayed
+type replayKey struct{}
+
+// IsReplay returns true if the context is of a fire made by Replay.
+// Handlers that have external effects, e.g. sending an email or calling
+// the gateway, should skip them during replays while still updating
+// the subject:
+//
+//	OnContext: func(ctx context.Context, args ...any) error {
+//		xfr.AuthorizedAmount = args[0].(int)
+//		if IsReplay(ctx) {
+//			return nil
+//		}
+//		return gateway.Authorize(xfr)
+//	},
+func IsReplay(ctx context.Context) bool {
+	return replayed(ctx) != nil
+}
+
+// replayed returns the record replayed by the fire of the context, or
+// nil if it's not a replay
+func replayed(ctx context.Context) *TransitionRecord {
+	record, _ := ctx.Value(replayKey{}).(*TransitionRecord)
+	return record
+}
+
+// Replay rebuilds the subject and the state by firing the events of the
+// records in order, with a context for which IsReplay returns true. The
+// guards and On are called as in a live fire, but After, the effects,
+// the timeouts and the automatic and deferred events are not, as the
+// records already contain the transitions they caused. The observers,
+// the event channel, Metrics and Telemetry are not notified either,
+// and the rate limits and MaxTransitions don't apply: the transitions
+// were already made. The rebuilt history keeps the IDs and CausedBy of
+// the records. Replay returns
+// ErrReplayDiverged when a fire ends in another state than its record.
+// Records of failed fires are skipped.
+func (sm *StateMachine) Replay(ctx context.Context, records []TransitionRecord) error {
+	sm.lockFire()
+	defer sm.unlockFire()
+
+	return sm.replay(ctx, records)
+}
+
+// replay fires the events of the records. The caller must hold the
+// lock.
+func (sm *StateMachine) replay(ctx context.Context, records []TransitionRecord) error {
+	for i, record := range records {
+		if record.Error != "" {
+			continue
+		}
+
+		ctx := context.WithValue(ctx, replayKey{}, &records[i])
+
+		if err := sm.fire(ctx, record.Event, record.Args...); err != nil {
+			return fmt.Errorf("replaying record %d of event %s: %w", i, record.Event, err)
+		}
+
+		state, err := sm.loadState(ctx)
+		if err != nil {
+			return fmt.Errorf("replaying record %d of event %s: loading state: %w", i, record.Event, err)
+		}
+
+		if state != record.To {
+			return fmt.Errorf("replaying record %d of event %s: state %s instead of %s: %w", i, record.Event, state, record.To, ErrReplayDiverged)
+		}
+	}
+
+	return nil
+}
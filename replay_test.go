@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaySkipsSideEffects(t *testing.T) {
+	type gatewayCall struct {
+		amount int
+	}
+
+	newMachine := func(xfr *Transfer, calls *[]gatewayCall) *StateMachine {
+		sm := NewStateMachine(Options{
+			CurrentState: StatePending,
+		})
+		sm.SetEvents(map[string]Event{
+			"authorize": {
+				Transitions: []Transition{{
+					From: StatePending,
+					To:   StateAuthorized,
+					OnContext: func(ctx context.Context, args ...any) error {
+						xfr.AuthorizedAmount = args[0].(int)
+
+						if IsReplay(ctx) {
+							return nil
+						}
+
+						*calls = append(*calls, gatewayCall{amount: args[0].(int)})
+
+						return nil
+					},
+				}},
+			},
+		})
+
+		return sm
+	}
+
+	liveXfr := &Transfer{ID: "xfr"}
+	var liveCalls []gatewayCall
+
+	live := newMachine(liveXfr, &liveCalls)
+	require.NoError(t, live.Fire("authorize", 100))
+	require.Equal(t, []gatewayCall{{amount: 100}}, liveCalls)
+
+	rebuiltXfr := &Transfer{ID: "xfr"}
+	var rebuiltCalls []gatewayCall
+
+	rebuilt := newMachine(rebuiltXfr, &rebuiltCalls)
+	require.NoError(t, rebuilt.Replay(context.Background(), live.History()))
+
+	require.Empty(t, rebuiltCalls)
+	require.Equal(t, liveXfr, rebuiltXfr)
+	require.Equal(t, StateAuthorized, rebuilt.State())
+}
+
+func TestReplayDiverged(t *testing.T) {
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(transferEvents(&Transfer{}))
+
+	err := sm.Replay(context.Background(), []TransitionRecord{
+		{Event: "authorize", From: StatePending, To: StateCaptured, Args: []any{100}},
+	})
+	require.ErrorIs(t, err, ErrReplayDiverged)
+}
+
+func TestReplayIsNotObserved(t *testing.T) {
+	var observed []TransitionRecord
+	telemetry := &recordingTelemetry{}
+	metrics := &failureRecorder{}
+
+	events := transferEvents(&Transfer{})
+	capture := events["capture"]
+	capture.Transitions[0].RateLimit = &RateLimit{Burst: 0}
+	events["capture"] = capture
+	events["refund"] = Event{
+		Transitions: []Transition{{From: StateCaptured, To: StateVoided}},
+	}
+
+	sm := NewStateMachine(Options{
+		CurrentState:       StatePending,
+		SubjectID:          "xfr",
+		MaxTransitions:     1,
+		EventChannelBuffer: 10,
+		Telemetry:          telemetry,
+		Metrics:            metrics,
+		OnTransition: func(record TransitionRecord) {
+			observed = append(observed, record)
+		},
+	})
+	sm.SetEvents(events)
+	ch := sm.Events()
+
+	err := sm.Replay(context.Background(), []TransitionRecord{
+		{ID: "xfr/1", Event: "authorize", From: StatePending, To: StateAuthorized, Args: []any{100}},
+		{ID: "xfr/2", CausedBy: "xfr/1", Event: "capture", From: StateAuthorized, To: StateCaptured},
+	})
+	require.NoError(t, err)
+	require.Equal(t, StateCaptured, sm.State())
+
+	history := sm.History()
+	require.Len(t, history, 2)
+	require.Equal(t, "xfr/1", history[0].ID)
+	require.Equal(t, "xfr/2", history[1].ID)
+	require.Equal(t, "xfr/1", history[1].CausedBy)
+
+	require.Empty(t, observed)
+	require.Empty(t, telemetry.phases)
+	require.Empty(t, metrics.reasons)
+	require.Empty(t, ch)
+
+	// the replayed transitions don't count against the budget
+	require.NoError(t, sm.Fire("refund"))
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrSubjectNotFound = fmt.Errorf("subject not found")
+
+// MemoryRepository is a Repository keeping the states in memory, for
+// tests and single-process deployments. Like SELECT ... FOR UPDATE, a
+// transaction locks the subjects it loads or saves until it ends, so
+// the transactions of a subject are serialized while those of other
+// subjects run concurrently. Saves are only visible to others once
+// committed.
+type MemoryRepository struct {
+	mu     sync.Mutex
+	states map[string]State
+
+	// locks serialize the transactions per subject
+	locks map[string]*sync.Mutex
+}
+
+// memoryTxKey is the context key of the transaction of
+// MemoryRepository
+type memoryTxKey struct{}
+
+// memoryTx holds the states saved in a transaction until it's committed
+type memoryTx struct {
+	repo   *MemoryRepository
+	states map[string]State
+
+	// locked are the locks of the subjects held by the transaction
+	locked map[string]*sync.Mutex
+}
+
+func NewMemoryRepository(states map[string]State) *MemoryRepository {
+	copied := make(map[string]State, len(states))
+	for id, state := range states {
+		copied[id] = state
+	}
+
+	return &MemoryRepository{
+		states: copied,
+		locks:  make(map[string]*sync.Mutex),
+	}
+}
+
+func (r *MemoryRepository) txFromContext(ctx context.Context) *memoryTx {
+	tx, ok := ctx.Value(memoryTxKey{}).(*memoryTx)
+	if !ok || tx.repo != r {
+		return nil
+	}
+
+	return tx
+}
+
+// lock locks the subject for the rest of the transaction, waiting for
+// the transaction holding it, if any
+func (tx *memoryTx) lock(id string) {
+	if _, ok := tx.locked[id]; ok {
+		return
+	}
+
+	tx.repo.mu.Lock()
+	lock, ok := tx.repo.locks[id]
+	if !ok {
+		lock = &sync.Mutex{}
+		tx.repo.locks[id] = lock
+	}
+	tx.repo.mu.Unlock()
+
+	lock.Lock()
+	tx.locked[id] = lock
+}
+
+// LoadState returns the state of the subject or ErrSubjectNotFound
+func (r *MemoryRepository) LoadState(ctx context.Context, id string) (State, error) {
+	if tx := r.txFromContext(ctx); tx != nil {
+		tx.lock(id)
+		if state, ok := tx.states[id]; ok {
+			return state, nil
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, ok := r.states[id]
+	if !ok {
+		return "", fmt.Errorf("loading %s: %w", id, ErrSubjectNotFound)
+	}
+
+	return state, nil
+}
+
+func (r *MemoryRepository) SaveState(ctx context.Context, id string, state State) error {
+	if tx := r.txFromContext(ctx); tx != nil {
+		tx.lock(id)
+		tx.states[id] = state
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.states[id] = state
+
+	return nil
+}
+
+// WithTx calls fn in a transaction. A transaction started in a
+// transaction of the repository joins it.
+func (r *MemoryRepository) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if r.txFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	tx := &memoryTx{
+		repo:   r,
+		states: make(map[string]State),
+		locked: make(map[string]*sync.Mutex),
+	}
+
+	// the subjects are unlocked once the saves are committed
+	defer func() {
+		for _, lock := range tx.locked {
+			lock.Unlock()
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, memoryTxKey{}, tx)); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, state := range tx.states {
+		r.states[id] = state
+	}
+
+	return nil
+}
+
+// SQLRepository is a Repository storing the states in a table of a
+// Postgres database with database/sql. The table must have the schema:
+//
+//	CREATE TABLE <table> (
+//		id    TEXT PRIMARY KEY,
+//		state TEXT NOT NULL
+//	);
+//
+// In a transaction, LoadState locks the row of the subject with SELECT
+// ... FOR UPDATE, so concurrent fires of the same subject are
+// serialized by the database. OnContext handlers can update the subject
+// in the same transaction with SQLTx.
+type SQLRepository struct {
+	db    *sql.DB
+	table string
+}
+
+// sqlTxKey is the context key of the transaction of SQLRepository
+type sqlTxKey struct{}
+
+func NewSQLRepository(db *sql.DB, table string) *SQLRepository {
+	return &SQLRepository{db: db, table: table}
+}
+
+// SQLTx returns the transaction started by SQLRepository.WithTx, or nil
+// if the context is not of a transaction
+func SQLTx(ctx context.Context) *sql.Tx {
+	tx, _ := ctx.Value(sqlTxKey{}).(*sql.Tx)
+	return tx
+}
+
+// LoadState returns the state of the subject or ErrSubjectNotFound
+func (r *SQLRepository) LoadState(ctx context.Context, id string) (State, error) {
+	query := fmt.Sprintf("SELECT state FROM %s WHERE id = $1", sqlIdentifier(r.table))
+
+	var row *sql.Row
+	if tx := SQLTx(ctx); tx != nil {
+		row = tx.QueryRowContext(ctx, query+" FOR UPDATE", id)
+	} else {
+		row = r.db.QueryRowContext(ctx, query, id)
+	}
+
+	var state string
+	if err := row.Scan(&state); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("loading %s: %w", id, ErrSubjectNotFound)
+		}
+		return "", fmt.Errorf("loading %s: %w", id, err)
+	}
+
+	return State(state), nil
+}
+
+// SaveState inserts or updates the state of the subject
+func (r *SQLRepository) SaveState(ctx context.Context, id string, state State) error {
+	query := fmt.Sprintf("INSERT INTO %s (id, state) VALUES ($1, $2) ON CONFLICT (id) DO UPDATE SET state = EXCLUDED.state", sqlIdentifier(r.table))
+
+	var err error
+	if tx := SQLTx(ctx); tx != nil {
+		_, err = tx.ExecContext(ctx, query, id, string(state))
+	} else {
+		_, err = r.db.ExecContext(ctx, query, id, string(state))
+	}
+	if err != nil {
+		return fmt.Errorf("saving %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// WithTx calls fn in a database transaction, committing it if fn
+// returns nil and rolling it back otherwise. A transaction started in
+// a transaction joins it.
+func (r *SQLRepository) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if SQLTx(ctx) != nil {
+		return fn(ctx)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	if err := fn(context.WithValue(ctx, sqlTxKey{}, tx)); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return fmt.Errorf("%w (rolling back: %s)", err, rollbackErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
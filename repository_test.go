@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRepositorySerializesFires(t *testing.T) {
+	repo := NewMemoryRepository(map[string]State{"xfr": StatePending})
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+
+	// machines of the same transfer in different goroutines
+	for i := range errs {
+		sm := NewStateMachine(Options{
+			Repository: repo,
+			SubjectID:  "xfr",
+		})
+		sm.SetEvents(transferEvents(&Transfer{}))
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = sm.Fire("authorize", 100)
+		}(i)
+	}
+	wg.Wait()
+
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	require.Len(t, failed, 1)
+	require.ErrorIs(t, failed[0], ErrNoTransitionForEvent)
+
+	state, err := repo.LoadState(context.Background(), "xfr")
+	require.NoError(t, err)
+	require.Equal(t, StateAuthorized, state)
+
+	_, err = repo.LoadState(context.Background(), "unknown")
+	require.ErrorIs(t, err, ErrSubjectNotFound)
+}
+
+func TestMemoryRepositoryLocksPerSubject(t *testing.T) {
+	repo := NewMemoryRepository(map[string]State{
+		"xfr1": StatePending,
+		"xfr2": StatePending,
+	})
+
+	locked := make(chan struct{})
+	release := make(chan struct{})
+
+	done := make(chan error)
+	go func() {
+		done <- repo.WithTx(context.Background(), func(ctx context.Context) error {
+			if _, err := repo.LoadState(ctx, "xfr1"); err != nil {
+				return err
+			}
+			close(locked)
+			<-release
+			return repo.SaveState(ctx, "xfr1", StateAuthorized)
+		})
+	}()
+	<-locked
+
+	// the transaction of another subject doesn't wait
+	err := repo.WithTx(context.Background(), func(ctx context.Context) error {
+		return repo.SaveState(ctx, "xfr2", StateAuthorized)
+	})
+	require.NoError(t, err)
+
+	// the transaction of the same subject waits for the first one
+	waiting := make(chan State)
+	go func() {
+		_ = repo.WithTx(context.Background(), func(ctx context.Context) error {
+			state, _ := repo.LoadState(ctx, "xfr1")
+			waiting <- state
+			return nil
+		})
+	}()
+
+	select {
+	case <-waiting:
+		t.Fatal("transaction didn't wait for the lock of the subject")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(release)
+	require.NoError(t, <-done)
+	require.Equal(t, StateAuthorized, <-waiting)
+}
+
+func TestMemoryRepositoryRollback(t *testing.T) {
+	repo := NewMemoryRepository(map[string]State{"xfr": StateAuthorized})
+
+	sm := NewStateMachine(Options{
+		Repository: repo,
+		SubjectID:  "xfr",
+	})
+	sm.SetEvents(map[string]Event{
+		"capture": {
+			Transitions: []Transition{{
+				From: StateAuthorized,
+				To:   StateCaptured,
+				OnContext: func(ctx context.Context, args ...any) error {
+					// the new state is saved after On, so it can't be
+					// seen even in the transaction
+					state, err := repo.LoadState(ctx, "xfr")
+					require.NoError(t, err)
+					require.Equal(t, StateAuthorized, state)
+
+					return fmt.Errorf("gateway error")
+				},
+			}},
+		},
+	})
+
+	require.Error(t, sm.Fire("capture"))
+
+	state, err := repo.LoadState(context.Background(), "xfr")
+	require.NoError(t, err)
+	require.Equal(t, StateAuthorized, state)
+}
+
+func TestSQLRepository(t *testing.T) {
+	conn := &fakeSQLConn{states: map[string]string{"xfr": "pending"}}
+	db := sql.OpenDB(fakeSQLConnector{conn: conn})
+	defer db.Close()
+
+	repo := NewSQLRepository(db, "transfer_states")
+
+	var inTx bool
+
+	sm := NewStateMachine(Options{
+		Repository: repo,
+		SubjectID:  "xfr",
+	})
+	sm.SetEvents(map[string]Event{
+		"authorize": {
+			Transitions: []Transition{{
+				From: StatePending,
+				To:   StateAuthorized,
+				OnContext: func(ctx context.Context, args ...any) error {
+					inTx = SQLTx(ctx) != nil
+					return nil
+				},
+			}},
+		},
+	})
+
+	require.NoError(t, sm.Fire("authorize"))
+	require.True(t, inTx)
+
+	require.Equal(t, []string{
+		"BEGIN",
+		`SELECT state FROM "transfer_states" WHERE id = $1 FOR UPDATE [xfr]`,
+		`INSERT INTO "transfer_states" (id, state) VALUES ($1, $2) ON CONFLICT (id) DO UPDATE SET state = EXCLUDED.state [xfr authorized]`,
+		"COMMIT",
+	}, conn.log)
+	require.Equal(t, "authorized", conn.states["xfr"])
+
+	_, err := repo.LoadState(context.Background(), "unknown")
+	require.ErrorIs(t, err, ErrSubjectNotFound)
+}
+
+// fakeSQLConnector connects database/sql to fakeSQLConn
+type fakeSQLConnector struct {
+	conn *fakeSQLConn
+}
+
+func (c fakeSQLConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.conn, nil
+}
+
+func (c fakeSQLConnector) Driver() driver.Driver {
+	return nil
+}
+
+// fakeSQLConn is a database connection understanding only the queries
+// of SQLRepository. It logs the statements it executes.
+type fakeSQLConn struct {
+	states map[string]string
+	log    []string
+}
+
+func (c *fakeSQLConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeSQLStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeSQLConn) Close() error {
+	return nil
+}
+
+func (c *fakeSQLConn) Begin() (driver.Tx, error) {
+	c.log = append(c.log, "BEGIN")
+	return c, nil
+}
+
+func (c *fakeSQLConn) Commit() error {
+	c.log = append(c.log, "COMMIT")
+	return nil
+}
+
+func (c *fakeSQLConn) Rollback() error {
+	c.log = append(c.log, "ROLLBACK")
+	return nil
+}
+
+type fakeSQLStmt struct {
+	conn  *fakeSQLConn
+	query string
+}
+
+func (s *fakeSQLStmt) Close() error {
+	return nil
+}
+
+func (s *fakeSQLStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeSQLStmt) record(args []driver.Value) {
+	s.conn.log = append(s.conn.log, fmt.Sprintf("%s %v", s.query, args))
+}
+
+func (s *fakeSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.record(args)
+	s.conn.states[args[0].(string)] = args[1].(string)
+
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.record(args)
+
+	rows := &fakeSQLRows{}
+	if state, ok := s.conn.states[args[0].(string)]; ok {
+		rows.values = []string{state}
+	}
+
+	return rows, nil
+}
+
+type fakeSQLRows struct {
+	values []string
+}
+
+func (r *fakeSQLRows) Columns() []string {
+	return []string{"state"}
+}
+
+func (r *fakeSQLRows) Close() error {
+	return nil
+}
+
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+
+	dest[0] = r.values[0]
+	r.values = r.values[1:]
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// StateResolver resolves the current state of the subject and commits
+// its transitions, so the machine doesn't depend on where the state is
+// kept
+type StateResolver interface {
+	// Current returns the current state of the subject
+	Current(ctx context.Context) (State, error)
+
+	// Commit records the transition of the subject from one state to
+	// another
+	Commit(ctx context.Context, from, to State) error
+}
+
+// MemoryStateResolver keeps the state in memory
+type MemoryStateResolver struct {
+	mu    sync.Mutex
+	state State
+}
+
+func NewMemoryStateResolver(initial State) *MemoryStateResolver {
+	return &MemoryStateResolver{state: initial}
+}
+
+func (r *MemoryStateResolver) Current(ctx context.Context) (State, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.state, nil
+}
+
+func (r *MemoryStateResolver) Commit(ctx context.Context, from, to State) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.state = to
+
+	return nil
+}
+
+// RepositoryStateResolver loads and persists the state of the subject
+// with the repository. It's used when Options.Repository is set.
+type RepositoryStateResolver struct {
+	Repository Repository
+	SubjectID  string
+}
+
+func (r *RepositoryStateResolver) Current(ctx context.Context) (State, error) {
+	return r.Repository.LoadState(ctx, r.SubjectID)
+}
+
+func (r *RepositoryStateResolver) Commit(ctx context.Context, from, to State) error {
+	return r.Repository.SaveState(ctx, r.SubjectID, to)
+}
+
+func (r *RepositoryStateResolver) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return r.Repository.WithTx(ctx, fn)
+}
+
+// StateChange is an entry of the log of EventLogStateResolver
+type StateChange struct {
+	From State
+	To   State
+}
+
+// EventLogStateResolver computes the current state from an append-only
+// log of state changes. The state is the initial one until the first
+// change is committed.
+type EventLogStateResolver struct {
+	mu      sync.Mutex
+	initial State
+	log     []StateChange
+}
+
+// NewEventLogStateResolver returns a resolver replaying the changes of
+// the log on top of the initial state
+func NewEventLogStateResolver(initial State, log ...StateChange) *EventLogStateResolver {
+	return &EventLogStateResolver{
+		initial: initial,
+		log:     log,
+	}
+}
+
+func (r *EventLogStateResolver) Current(ctx context.Context) (State, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state := r.initial
+	for _, change := range r.log {
+		state = change.To
+	}
+
+	return state, nil
+}
+
+func (r *EventLogStateResolver) Commit(ctx context.Context, from, to State) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.log = append(r.log, StateChange{From: from, To: to})
+
+	return nil
+}
+
+// Log returns a copy of the committed state changes
+func (r *EventLogStateResolver) Log() []StateChange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log := make([]StateChange, len(r.log))
+	copy(log, r.log)
+
+	return log
+}
+
+// TxStateResolver is a StateResolver that can resolve and commit the
+// state in a transaction. Fire runs On and Commit in the transaction
+// and calls After once it's committed.
+type TxStateResolver interface {
+	StateResolver
+
+	// WithTx calls fn in a transaction, committing it if fn returns
+	// nil and rolling it back otherwise
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// withTx calls fn in a transaction of the resolver if it supports them
+func (sm *StateMachine) withTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	resolver, ok := sm.resolver.(TxStateResolver)
+	if !ok {
+		return fn(ctx)
+	}
+
+	return resolver.WithTx(ctx, fn)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateResolvers(t *testing.T) {
+	eventLog := NewEventLogStateResolver(StatePending)
+
+	resolvers := map[string]StateResolver{
+		"memory": NewMemoryStateResolver(StatePending),
+		"repository": &RepositoryStateResolver{
+			Repository: newFakeRepository(map[string]State{"xfr": StatePending}),
+			SubjectID:  "xfr",
+		},
+		"event log": eventLog,
+	}
+
+	for name, resolver := range resolvers {
+		t.Run(name, func(t *testing.T) {
+			xfr := &Transfer{ID: "xfr"}
+
+			sm := NewStateMachine(Options{StateResolver: resolver})
+			sm.SetEvents(transferEvents(xfr))
+
+			require.Equal(t, StatePending, sm.State())
+			require.ErrorIs(t, sm.Fire("capture"), ErrNoTransitionForEvent)
+
+			require.NoError(t, sm.Fire("authorize", 100))
+			require.Equal(t, StateAuthorized, sm.State())
+			require.Equal(t, 100, xfr.AuthorizedAmount)
+
+			current, err := resolver.Current(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, StateAuthorized, current)
+		})
+	}
+
+	require.Equal(t, []StateChange{{From: StatePending, To: StateAuthorized}}, eventLog.Log())
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// RetryPolicy defines how On of idempotent events is retried when it
+// fails
+type RetryPolicy struct {
+	// MaxAttempts is the total number of On calls, including the first
+	// one
+	MaxAttempts int
+
+	// Backoff is the time waited between attempts
+	Backoff time.Duration
+}
+
+// callOn calls On of the transition, retrying it according to the
+// retry policy when the event is idempotent. Effectful events are
+// called only once because retrying them could repeat the effect.
+func (sm *StateMachine) callOn(event Event, transition Transition, args []any) error {
+	attempts := 1
+	if sm.retry != nil && event.Idempotent && sm.retry.MaxAttempts > 1 {
+		attempts = sm.retry.MaxAttempts
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = transition.On(args...)
+		if err == nil || errors.Is(err, ErrNoChange) {
+			return err
+		}
+
+		if attempt < attempts && sm.retry.Backoff > 0 {
+			sm.sleep(sm.retry.Backoff)
+		}
+	}
+
+	return err
+}
+
+// sleep waits for the duration using the clock of the machine
+func (sm *StateMachine) sleep(d time.Duration) {
+	done := make(chan struct{})
+	sm.clock.AfterFunc(d, func() { close(done) })
+	<-done
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryIdempotentEvents(t *testing.T) {
+	calls := map[string]int{}
+
+	failOnce := func(name string) func(args ...any) error {
+		return func(args ...any) error {
+			calls[name]++
+			if calls[name] == 1 {
+				return fmt.Errorf("gateway timeout")
+			}
+			return nil
+		}
+	}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		Retry:        &RetryPolicy{MaxAttempts: 3},
+	})
+	sm.SetEvents(map[string]Event{
+		"authorize": {
+			Idempotent: true,
+			Transitions: []Transition{
+				{From: StatePending, To: StateAuthorized, On: failOnce("authorize")},
+			},
+		},
+		"capture": {
+			Transitions: []Transition{
+				{From: StateAuthorized, To: StateCaptured, On: failOnce("capture")},
+			},
+		},
+	})
+
+	require.NoError(t, sm.Fire("authorize"))
+	require.Equal(t, 2, calls["authorize"])
+
+	err := sm.Fire("capture")
+	require.EqualError(t, err, "error during transition from authorized to captured: gateway timeout")
+	require.Equal(t, 1, calls["capture"])
+	require.Equal(t, StateAuthorized, sm.State())
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is a panic of a callback recovered in safe mode
+type PanicError struct {
+	Event string
+
+	// Callback is the recovered callback, e.g. Guard, On or OnTransition
+	Callback string
+	Value    any
+
+	// Stack is the stack trace of the goroutine that panicked
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("event %s: %s panicked: %v", e.Event, e.Callback, e.Value)
+}
+
+// protect calls the callback. In safe mode a panic of the callback is
+// recovered, reported to the panic observer and returned as a
+// *PanicError.
+func (sm *StateMachine) protect(event, callback string, fn func() error) (err error) {
+	if !sm.safeMode {
+		return fn()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			p := &PanicError{
+				Event:    event,
+				Callback: callback,
+				Value:    r,
+				Stack:    debug.Stack(),
+			}
+
+			if sm.onPanic != nil {
+				sm.onPanic(p)
+			}
+
+			err = p
+		}
+	}()
+
+	return fn()
+}
+
+// notify calls a callback whose failure must not affect the
+// transition, e.g. an observer. In safe mode its panic is reported to
+// the error handler as well, as there is no caller to return it to.
+func (sm *StateMachine) notify(event, callback string, fn func()) {
+	err := sm.protect(event, callback, func() error {
+		fn()
+		return nil
+	})
+
+	if err != nil {
+		sm.handleError(event, err)
+	}
+}
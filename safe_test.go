@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSafeModeObserverPanic(t *testing.T) {
+	var panics []*PanicError
+	var handled []error
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		SafeMode:     true,
+		OnTransition: func(record TransitionRecord) {
+			panic("observer is broken")
+		},
+		OnPanic: func(p *PanicError) {
+			panics = append(panics, p)
+		},
+		ErrorHandler: func(event string, err error) error {
+			handled = append(handled, err)
+			return err
+		},
+	})
+	sm.SetEvents(transferEvents(&Transfer{}))
+
+	err := sm.Fire("authorize", 100)
+	require.NoError(t, err)
+	require.Equal(t, StateAuthorized, sm.State())
+
+	require.Len(t, panics, 1)
+	require.Equal(t, "authorize", panics[0].Event)
+	require.Equal(t, "OnTransition", panics[0].Callback)
+	require.Equal(t, "observer is broken", panics[0].Value)
+	require.Contains(t, string(panics[0].Stack), "TestSafeModeObserverPanic")
+
+	require.Len(t, handled, 1)
+	require.EqualError(t, handled[0], "event authorize: OnTransition panicked: observer is broken")
+}
+
+// panickingTelemetry panics at every phase of a fire
+type panickingTelemetry struct{}
+
+func (panickingTelemetry) TransitionStarted(TransitionResult)   { panic("telemetry is broken") }
+func (panickingTelemetry) TransitionCommitted(TransitionResult) { panic("telemetry is broken") }
+func (panickingTelemetry) TransitionRejected(TransitionResult)  { panic("telemetry is broken") }
+func (panickingTelemetry) TransitionFailed(TransitionResult)    { panic("telemetry is broken") }
+
+// panickingMetrics panics for every fire
+type panickingMetrics struct{}
+
+func (panickingMetrics) TransitionCompleted(event, from, to string) { panic("metrics are broken") }
+func (panickingMetrics) TransitionFailed(event, reason string)      { panic("metrics are broken") }
+
+func TestSafeModeTelemetryAndMetricsPanic(t *testing.T) {
+	var callbacks []string
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		SafeMode:     true,
+		Telemetry:    panickingTelemetry{},
+		Metrics:      panickingMetrics{},
+		OnPanic: func(p *PanicError) {
+			callbacks = append(callbacks, p.Callback)
+		},
+	})
+	sm.SetEvents(transferEvents(&Transfer{}))
+
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.Equal(t, StateAuthorized, sm.State())
+	require.Equal(t, []string{"Telemetry", "Telemetry", "Metrics"}, callbacks)
+
+	callbacks = nil
+
+	require.ErrorIs(t, sm.Fire("authorize", 100), ErrNoTransitionForEvent)
+	require.Equal(t, []string{"Telemetry", "Metrics", "Telemetry"}, callbacks)
+}
+
+func TestSafeModeOnPanic(t *testing.T) {
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		SafeMode:     true,
+	})
+	sm.SetEvents(map[string]Event{
+		"authorize": {
+			Transitions: []Transition{
+				{
+					From: StatePending,
+					To:   StateAuthorized,
+					On: func(args ...any) error {
+						_ = args[0].(int)
+						return nil
+					},
+				},
+			},
+		},
+	})
+
+	err := sm.Fire("authorize")
+
+	var p *PanicError
+	require.True(t, errors.As(err, &p))
+	require.Equal(t, "On", p.Callback)
+	require.Equal(t, StatePending, sm.State())
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ArgField declares a named argument of an event. Type is the Go type
+// name of the value, e.g. int or string.
+type ArgField struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Required bool   `json:"required,omitempty"`
+}
+
+// ArgsSchema declares the arguments of an event in the order they are
+// passed to guards and callbacks
+type ArgsSchema []ArgField
+
+// ArgProblem is a problem of a single argument
+type ArgProblem struct {
+	Field   string
+	Problem string
+}
+
+// ArgsValidationError lists all problems of the params of a fire
+type ArgsValidationError struct {
+	Event    string
+	Problems []ArgProblem
+}
+
+func (e *ArgsValidationError) Error() string {
+	problems := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		problems[i] = problem.Field + ": " + problem.Problem
+	}
+
+	return fmt.Sprintf("event %s: invalid args: %s", e.Event, strings.Join(problems, "; "))
+}
+
+// validate checks the params against the schema and returns them as
+// positional args. Trailing optional args that are missing are
+// omitted.
+func (schema ArgsSchema) validate(event string, params map[string]any) ([]any, error) {
+	var problems []ArgProblem
+
+	known := make(map[string]bool, len(schema))
+	args := make([]any, len(schema))
+	last := -1
+
+	for i, field := range schema {
+		known[field.Name] = true
+
+		value, ok := params[field.Name]
+		if !ok {
+			if field.Required {
+				problems = append(problems, ArgProblem{Field: field.Name, Problem: "required"})
+			}
+			continue
+		}
+
+		if typ := fmt.Sprintf("%T", value); typ != field.Type {
+			problems = append(problems, ArgProblem{
+				Field:   field.Name,
+				Problem: fmt.Sprintf("expected %s, got %s", field.Type, typ),
+			})
+			continue
+		}
+
+		args[i] = value
+		last = i
+	}
+
+	var unknown []string
+	for name := range params {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+
+	for _, name := range unknown {
+		problems = append(problems, ArgProblem{Field: name, Problem: "unknown"})
+	}
+
+	if len(problems) > 0 {
+		return nil, &ArgsValidationError{Event: event, Problems: problems}
+	}
+
+	return args[:last+1], nil
+}
+
+// FireValidated validates the params against the ArgsSchema of the
+// event and fires it with the params as positional args in the order
+// of the schema. All problems of the params are returned at once as an
+// *ArgsValidationError.
+func (sm *StateMachine) FireValidated(name string, params map[string]any) error {
+	sm.lockFire()
+	defer sm.unlockFire()
+
+	event, ok := sm.events[name]
+	if !ok {
+		return sm.handleError(name, ErrEventNotFound)
+	}
+
+	args, err := event.ArgsSchema.validate(name, params)
+	if err != nil {
+		sm.countFailure(name, err)
+		return sm.handleError(name, err)
+	}
+
+	return sm.handleError(name, sm.fire(context.Background(), name, args...))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFireValidated(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	events := transferEvents(xfr)
+	for _, name := range []string{"authorize", "void"} {
+		event := events[name]
+		event.ArgsSchema = ArgsSchema{
+			{Name: "amount", Type: "int", Required: true},
+			{Name: "reason", Type: "string"},
+		}
+		events[name] = event
+	}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(events)
+
+	require.NoError(t, sm.FireValidated("authorize", map[string]any{"amount": 100}))
+
+	err := sm.FireValidated("void", map[string]any{"reason": "customer request"})
+
+	var validationErr *ArgsValidationError
+	require.True(t, errors.As(err, &validationErr))
+	require.Equal(t, []ArgProblem{{Field: "amount", Problem: "required"}}, validationErr.Problems)
+	require.EqualError(t, err, "event void: invalid args: amount: required")
+
+	err = sm.FireValidated("void", map[string]any{"amount": "50", "note": "x"})
+	require.EqualError(t, err, "event void: invalid args: amount: expected int, got string; note: unknown")
+
+	require.Equal(t, StateAuthorized, sm.State())
+
+	require.NoError(t, sm.FireValidated("void", map[string]any{"amount": 50}))
+	require.Equal(t, StatePartiallyAuthorized, sm.State())
+	require.Equal(t, 50, xfr.VoidedAmount)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// maxSimulationSteps bounds a single simulation run in case the machine
+// has cycles that are never left
+const maxSimulationSteps = 1000
+
+type simulationEdge struct {
+	to     State
+	weight float64
+}
+
+// Simulate runs n subjects through the machine starting from its
+// initial state. At each step one of the transitions from the current
+// state is picked at random, proportionally to its Weight, until a
+// state without outgoing transitions is reached. It returns how many
+// runs ended in each state.
+//
+// Guards, On and After are not called: the simulation is based only on
+// the structure of the machine. Disabled events are skipped and a zero
+// Weight counts as 1.
+func Simulate(sm *StateMachine, n int, rng *rand.Rand) map[State]int {
+	sm.mu.Lock()
+	initial := sm.initialState
+	edges := sm.simulationEdges()
+	sm.mu.Unlock()
+
+	results := make(map[State]int)
+	for i := 0; i < n; i++ {
+		results[simulateRun(initial, edges, rng)]++
+	}
+
+	return results
+}
+
+// SimulateParallel runs the simulation like Simulate on a pool of
+// workers. Every run i uses its own source of randomness seeded with
+// seedFn(i), so the results depend only on the seeds and not on the
+// number of workers or the scheduling.
+func SimulateParallel(sm *StateMachine, runs int, workers int, seedFn func(i int) int64) map[State]int {
+	sm.mu.Lock()
+	initial := sm.initialState
+	edges := sm.simulationEdges()
+	sm.mu.Unlock()
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan int)
+	results := make(map[State]int)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			tally := make(map[State]int)
+			for i := range jobs {
+				rng := rand.New(rand.NewSource(seedFn(i)))
+				tally[simulateRun(initial, edges, rng)]++
+			}
+
+			mu.Lock()
+			for state, count := range tally {
+				results[state] += count
+			}
+			mu.Unlock()
+		}()
+	}
+
+	for i := 0; i < runs; i++ {
+		jobs <- i
+	}
+	close(jobs)
+
+	wg.Wait()
+
+	return results
+}
+
+func simulateRun(state State, edges map[State][]simulationEdge, rng *rand.Rand) State {
+	for step := 0; step < maxSimulationSteps; step++ {
+		outgoing := edges[state]
+		if len(outgoing) == 0 {
+			return state
+		}
+
+		var total float64
+		for _, edge := range outgoing {
+			total += edge.weight
+		}
+
+		pick := rng.Float64() * total
+		next := outgoing[len(outgoing)-1].to
+		for _, edge := range outgoing {
+			if pick < edge.weight {
+				next = edge.to
+				break
+			}
+			pick -= edge.weight
+		}
+
+		state = next
+	}
+
+	return state
+}
+
+// simulationEdges returns the weighted transitions of the machine by
+// state, in event name order so simulations are reproducible. The
+// caller must hold the lock.
+func (sm *StateMachine) simulationEdges() map[State][]simulationEdge {
+	edges := make(map[State][]simulationEdge)
+	for _, name := range sm.eventNames {
+		event := sm.events[name]
+		if event.Disabled {
+			continue
+		}
+
+		for _, transition := range event.Transitions {
+			weight := transition.Weight
+			if weight <= 0 {
+				weight = 1
+			}
+
+			edges[transition.From] = append(edges[transition.From], simulationEdge{
+				to:     transition.To,
+				weight: weight,
+			})
+		}
+	}
+
+	return edges
+}
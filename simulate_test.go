@@ -0,0 +1,94 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulate(t *testing.T) {
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(map[string]Event{
+		"authorize": {
+			Transitions: []Transition{
+				{From: StatePending, To: StateAuthorized, Weight: 9},
+			},
+		},
+		"decline": {
+			Transitions: []Transition{
+				{From: StatePending, To: StateVoided, Weight: 1},
+			},
+		},
+		"capture": {
+			Transitions: []Transition{
+				{From: StateAuthorized, To: StateCaptured, Weight: 3},
+			},
+		},
+		"void": {
+			Transitions: []Transition{
+				{From: StateAuthorized, To: StateVoided, Weight: 1},
+			},
+		},
+	})
+
+	results := Simulate(sm, 1000, rand.New(rand.NewSource(42)))
+
+	total := 0
+	for _, count := range results {
+		total += count
+	}
+	require.Equal(t, 1000, total)
+	require.Len(t, results, 2)
+
+	// roughly 0.9 * 0.75 of the runs end up captured
+	require.InDelta(t, 675, results[StateCaptured], 50)
+
+	// the same seed gives the same distribution
+	require.Equal(t, map[State]int{
+		StateCaptured: 692,
+		StateVoided:   308,
+	}, Simulate(sm, 1000, rand.New(rand.NewSource(42))))
+}
+
+func TestSimulateParallel(t *testing.T) {
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(map[string]Event{
+		"authorize": {
+			Transitions: []Transition{
+				{From: StatePending, To: StateAuthorized, Weight: 9},
+			},
+		},
+		"decline": {
+			Transitions: []Transition{
+				{From: StatePending, To: StateVoided, Weight: 1},
+			},
+		},
+		"capture": {
+			Transitions: []Transition{
+				{From: StateAuthorized, To: StateCaptured, Weight: 3},
+			},
+		},
+		"void": {
+			Transitions: []Transition{
+				{From: StateAuthorized, To: StateVoided, Weight: 1},
+			},
+		},
+	})
+
+	seed := func(i int) int64 { return int64(i) * 7919 }
+
+	serial := map[State]int{}
+	for i := 0; i < 500; i++ {
+		for state, count := range Simulate(sm, 1, rand.New(rand.NewSource(seed(i)))) {
+			serial[state] += count
+		}
+	}
+
+	require.Equal(t, serial, SimulateParallel(sm, 500, 8, seed))
+	require.Equal(t, serial, SimulateParallel(sm, 500, 1, seed))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ToSQLSeed generates SQL creating the table of the transitions and
+// replacing its rows with a row per transition, keeping a database
+// copy of the definition in sync with the code. The seed can be run
+// again after the events changed. The table has the schema:
+//
+//	CREATE TABLE IF NOT EXISTS <table> (
+//		name       TEXT PRIMARY KEY, -- event.from.to
+//		event      TEXT NOT NULL,
+//		from_state TEXT NOT NULL,
+//		to_state   TEXT NOT NULL,
+//		guarded    BOOLEAN NOT NULL
+//	);
+//
+// The name of the second and later transitions of an event between
+// the same states gets their number, e.g. void.authorized.voided.2.
+// guarded is true when the transition has a Guard or a ContextGuard.
+// The table name is quoted, a schema can be given as schema.table.
+func (sm *StateMachine) ToSQLSeed(table string) string {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	table = sqlIdentifier(table)
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "CREATE TABLE IF NOT EXISTS %s (\n", table)
+	fmt.Fprintf(&b, "\tname TEXT PRIMARY KEY,\n")
+	fmt.Fprintf(&b, "\tevent TEXT NOT NULL,\n")
+	fmt.Fprintf(&b, "\tfrom_state TEXT NOT NULL,\n")
+	fmt.Fprintf(&b, "\tto_state TEXT NOT NULL,\n")
+	fmt.Fprintf(&b, "\tguarded BOOLEAN NOT NULL\n")
+	fmt.Fprintf(&b, ");\n")
+
+	// the rows of removed transitions are deleted too
+	fmt.Fprintf(&b, "BEGIN;\n")
+	fmt.Fprintf(&b, "DELETE FROM %s;\n", table)
+
+	for _, name := range sm.eventNames {
+		seen := map[string]int{}
+
+		for _, transition := range sm.events[name].Transitions {
+			key := fmt.Sprintf("%s.%s.%s", name, transition.From, transition.To)
+			seen[key]++
+			if n := seen[key]; n > 1 {
+				key = fmt.Sprintf("%s.%d", key, n)
+			}
+
+			fmt.Fprintf(&b, "INSERT INTO %s (name, event, from_state, to_state, guarded) VALUES (%s, %s, %s, %s, %t);\n",
+				table,
+				sqlString(key),
+				sqlString(name),
+				sqlString(string(transition.From)),
+				sqlString(string(transition.To)),
+				transition.guarded(),
+			)
+		}
+	}
+
+	fmt.Fprintf(&b, "COMMIT;\n")
+
+	return b.String()
+}
+
+// sqlString quotes the string as an SQL literal
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// sqlIdentifier quotes the parts of the dotted name as SQL identifiers
+func sqlIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = `"` + strings.ReplaceAll(part, `"`, `""`) + `"`
+	}
+
+	return strings.Join(parts, ".")
+}
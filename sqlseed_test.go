@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToSQLSeed(t *testing.T) {
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+
+	events := transferEvents(&Transfer{})
+	void := events["void"]
+	void.Transitions = append(void.Transitions, Transition{
+		From:  StateAuthorized,
+		To:    StateVoided,
+		Guard: func(args ...any) bool { return false },
+	})
+	events["void"] = void
+	sm.SetEvents(events)
+
+	seed := sm.ToSQLSeed("transitions")
+
+	require.Contains(t, seed, "CREATE TABLE IF NOT EXISTS \"transitions\" (")
+	require.Contains(t, seed, "BEGIN;\nDELETE FROM \"transitions\";\n")
+	require.Contains(t, seed, "INSERT INTO \"transitions\" (name, event, from_state, to_state, guarded) VALUES ('void.authorized.voided', 'void', 'authorized', 'voided', true);\n")
+	require.Contains(t, seed, "INSERT INTO \"transitions\" (name, event, from_state, to_state, guarded) VALUES ('void.authorized.voided.2', 'void', 'authorized', 'voided', true);\n")
+	require.Contains(t, seed, "INSERT INTO \"transitions\" (name, event, from_state, to_state, guarded) VALUES ('capture.authorized.captured', 'capture', 'authorized', 'captured', false);\n")
+	require.True(t, strings.HasSuffix(seed, "COMMIT;\n"))
+}
+
+func TestSQLString(t *testing.T) {
+	require.Equal(t, "'o''clock'", sqlString("o'clock"))
+}
+
+func TestSQLIdentifier(t *testing.T) {
+	require.Equal(t, `"transitions"`, sqlIdentifier("transitions"))
+	require.Equal(t, `"fsm"."transitions"`, sqlIdentifier("fsm.transitions"))
+	require.Equal(t, `"x""; DROP TABLE y; --"`, sqlIdentifier(`x"; DROP TABLE y; --`))
+}
@@ -0,0 +1,70 @@
+// Package statsd reports the metrics of the state machine to StatsD
+package statsd
+
+import (
+	"sort"
+	"time"
+)
+
+// Client is the subset of a StatsD client used by the adapter, e.g.
+// the DataDog StatsD client
+type Client interface {
+	Incr(name string, tags []string, rate float64) error
+	Timing(name string, value time.Duration, tags []string, rate float64) error
+}
+
+type Options struct {
+	// Prefix of the metric names. Defaults to fsm.
+	Prefix string
+
+	// Tags added to every metric, e.g. the meta of the machine
+	Tags map[string]string
+}
+
+// Metrics emits <prefix>.transition.<event> and
+// <prefix>.transition_failed.<event> counters, the latter tagged with
+// the reason, and <prefix>.on.duration timers. It implements the
+// Metrics and LatencyRecorder interfaces of the state machine.
+type Metrics struct {
+	client Client
+	prefix string
+	tags   []string
+}
+
+func New(client Client, opts Options) *Metrics {
+	prefix := opts.Prefix
+	if prefix == "" {
+		prefix = "fsm"
+	}
+
+	tags := make([]string, 0, len(opts.Tags))
+	for key, value := range opts.Tags {
+		tags = append(tags, key+":"+value)
+	}
+	sort.Strings(tags)
+
+	return &Metrics{
+		client: client,
+		prefix: prefix,
+		tags:   tags,
+	}
+}
+
+func (m *Metrics) withTags(tags ...string) []string {
+	all := make([]string, 0, len(m.tags)+len(tags))
+	all = append(all, m.tags...)
+
+	return append(all, tags...)
+}
+
+func (m *Metrics) TransitionCompleted(event, from, to string) {
+	m.client.Incr(m.prefix+".transition."+event, m.withTags("from:"+from, "to:"+to), 1)
+}
+
+func (m *Metrics) TransitionFailed(event, reason string) {
+	m.client.Incr(m.prefix+".transition_failed."+event, m.withTags("reason:"+reason), 1)
+}
+
+func (m *Metrics) ObserveOnDuration(event string, d time.Duration) {
+	m.client.Timing(m.prefix+".on.duration", d, m.withTags("event:"+event), 1)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// stepFunctionsMachine is a simplified Amazon States Language
+// definition
+type stepFunctionsMachine struct {
+	Comment string                        `json:"Comment"`
+	StartAt string                        `json:"StartAt"`
+	States  map[string]stepFunctionsState `json:"States"`
+}
+
+type stepFunctionsState struct {
+	Type     string              `json:"Type"`
+	Comment  string              `json:"Comment,omitempty"`
+	Choices  []stepFunctionsRule `json:"Choices,omitempty"`
+	Resource string              `json:"Resource,omitempty"`
+	Next     string              `json:"Next,omitempty"`
+}
+
+type stepFunctionsRule struct {
+	Variable     string `json:"Variable"`
+	StringEquals string `json:"StringEquals"`
+	Next         string `json:"Next"`
+}
+
+// ToStepFunctions exports the machine as a simplified Amazon States
+// Language definition starting at the current state, to bootstrap a
+// Step Functions state machine. Every state with transitions becomes a
+// Choice state routing on the $.event input to the next state, and
+// terminal states become Succeed states. Transitions with On go through
+// a Task state named <event>.<from>.<to> whose Resource is the handler
+// name of On, to be replaced with the ARN of the task.
+//
+// Guards, After and the options of the machine can't be expressed: the
+// transitions of an event from a state are all listed as choices, so
+// Step Functions always takes the first one.
+func (sm *StateMachine) ToStepFunctions() ([]byte, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	current, err := sm.loadState(context.Background())
+	if err != nil {
+		current = sm.currentState
+	}
+
+	states := make(map[string]stepFunctionsState)
+	for _, state := range sm.states() {
+		states[string(state)] = stepFunctionsState{Type: "Succeed"}
+	}
+
+	for _, name := range sm.eventNames {
+		for _, transition := range sm.events[name].Transitions {
+			next := string(transition.To)
+
+			if transition.On != nil || transition.OnContext != nil {
+				task := fmt.Sprintf("%s.%s.%s", name, transition.From, transition.To)
+				states[task] = stepFunctionsState{
+					Type:     "Task",
+					Resource: handlerName(name, transition, "On"),
+					Next:     next,
+				}
+				next = task
+			}
+
+			from := states[string(transition.From)]
+			from.Type = "Choice"
+			from.Choices = append(from.Choices, stepFunctionsRule{
+				Variable:     "$.event",
+				StringEquals: name,
+				Next:         next,
+			})
+			if transition.guarded() {
+				from.Comment = "guards are not exported, the first matching choice is taken"
+			}
+			states[string(transition.From)] = from
+		}
+	}
+
+	data, err := json.MarshalIndent(stepFunctionsMachine{
+		Comment: "Generated by ToStepFunctions",
+		StartAt: string(current),
+		States:  states,
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encoding states language definition: %w", err)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestToStepFunctions(t *testing.T) {
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(transferEvents(&Transfer{}))
+
+	data, err := sm.ToStepFunctions()
+	require.NoError(t, err)
+
+	var definition stepFunctionsMachine
+	require.NoError(t, json.Unmarshal(data, &definition))
+
+	require.Equal(t, "pending", definition.StartAt)
+
+	authorized := definition.States["authorized"]
+	require.Equal(t, "Choice", authorized.Type)
+	require.Equal(t, []stepFunctionsRule{
+		{Variable: "$.event", StringEquals: "capture", Next: "captured"},
+		{Variable: "$.event", StringEquals: "void", Next: "void.authorized.partially_authorized"},
+		{Variable: "$.event", StringEquals: "void", Next: "void.authorized.voided"},
+	}, authorized.Choices)
+
+	require.Equal(t, stepFunctionsState{
+		Type:     "Task",
+		Resource: "void.authorized.voided.On",
+		Next:     "voided",
+	}, definition.States["void.authorized.voided"])
+
+	require.Equal(t, "Succeed", definition.States["captured"].Type)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// SubMachine is a machine nested in a state of its parent, e.g. a
+// review flow inside authorized. The events the parent has no
+// transition for in the state are fired on the child. When the child
+// reaches one of the states of Completions, the parent fires the
+// mapped event, which usually transitions it out of the state. The
+// child is not reset when the parent enters the state again.
+type SubMachine struct {
+	Machine *StateMachine
+
+	// Completions maps the terminal states of the child to the events
+	// fired on the parent
+	Completions map[State]string
+}
+
+// handles returns true if the event has a transition from the state.
+// The caller must hold the lock.
+func (sm *StateMachine) handles(name string, state State) bool {
+	event, ok := sm.events[name]
+	if !ok {
+		return false
+	}
+
+	for _, transition := range event.Transitions {
+		if sm.matchesFrom(state, transition.From) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// delegate fires the event on the sub-machine of the state and fires
+// the completion event on the parent if the child reached a terminal
+// state. The caller must hold the lock of the parent.
+func (sm *StateMachine) delegate(ctx context.Context, state State, sub SubMachine, name string, args []any) error {
+	child := sub.Machine
+
+	child.mu.Lock()
+	err := child.fire(ctx, name, args...)
+	childState, loadErr := child.loadState(ctx)
+	child.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("sub-machine of %s: %w", state, err)
+	}
+	if loadErr != nil {
+		return fmt.Errorf("sub-machine of %s: loading state: %w", state, loadErr)
+	}
+
+	completion, ok := sub.Completions[childState]
+	if !ok {
+		return nil
+	}
+
+	return sm.fire(ctx, completion)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubMachine(t *testing.T) {
+	const (
+		stateReview   State = "review"
+		stateApproved State = "approved"
+	)
+
+	review := NewStateMachine(Options{CurrentState: stateReview})
+	review.SetEvents(map[string]Event{
+		"approve": {
+			Transitions: []Transition{{From: stateReview, To: stateApproved}},
+		},
+	})
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		SubMachines: map[State]SubMachine{
+			StateAuthorized: {
+				Machine:     review,
+				Completions: map[State]string{stateApproved: "capture"},
+			},
+		},
+	})
+	sm.SetEvents(transferEvents(&Transfer{}))
+
+	// approve is not handled by the parent outside of authorized
+	require.ErrorIs(t, sm.Fire("approve"), ErrEventNotFound)
+
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.Equal(t, stateReview, review.State())
+
+	require.NoError(t, sm.Fire("approve"))
+
+	require.Equal(t, stateApproved, review.State())
+	require.Equal(t, StateCaptured, sm.State())
+
+	history := sm.History()
+	require.Len(t, history, 2)
+	require.Equal(t, "capture", history[1].Event)
+}
@@ -0,0 +1,95 @@
+package main
+
+// TransitionResult describes a fire at one of its phases
+type TransitionResult struct {
+	Event string
+	From  State
+
+	// To is empty until a transition is selected
+	To       State
+	Args     []any
+	Warnings []string
+
+	// Err is the error of a rejected or failed fire
+	Err error
+
+	// BatchID is the ID of the batch of the fire, see StartBatch
+	BatchID string
+}
+
+// result returns the TransitionResult of the fire so far
+func (t *fireTrace) result(event string, args []any, err error) TransitionResult {
+	result := TransitionResult{
+		Event:    event,
+		From:     t.from,
+		Args:     args,
+		Warnings: t.warnings,
+		Err:      err,
+		BatchID:  t.batch,
+	}
+
+	if t.transition != nil {
+		result.To = t.transition.To
+	}
+
+	return result
+}
+
+// Telemetry is notified at every phase of a fire. It unifies logging,
+// metrics and tracing hooks into a single interface.
+type Telemetry interface {
+	// TransitionStarted is called once the current state is loaded
+	TransitionStarted(result TransitionResult)
+
+	// TransitionCommitted is called once the new state is persisted
+	TransitionCommitted(result TransitionResult)
+
+	// TransitionRejected is called when the event is unknown or not
+	// permitted from the current state
+	TransitionRejected(result TransitionResult)
+
+	// TransitionFailed is called when the selected transition fails,
+	// e.g. because On returned an error
+	TransitionFailed(result TransitionResult)
+}
+
+// NoopTelemetry ignores all phases. It can be embedded to implement
+// only some of the methods of Telemetry.
+type NoopTelemetry struct{}
+
+func (NoopTelemetry) TransitionStarted(TransitionResult)   {}
+func (NoopTelemetry) TransitionCommitted(TransitionResult) {}
+func (NoopTelemetry) TransitionRejected(TransitionResult)  {}
+func (NoopTelemetry) TransitionFailed(TransitionResult)    {}
+
+type multiTelemetry []Telemetry
+
+// MultiTelemetry returns a Telemetry notifying all of the telemetries
+// in order
+func MultiTelemetry(telemetries ...Telemetry) Telemetry {
+	return multiTelemetry(telemetries)
+}
+
+func (m multiTelemetry) TransitionStarted(result TransitionResult) {
+	for _, t := range m {
+		t.TransitionStarted(result)
+	}
+}
+
+func (m multiTelemetry) TransitionCommitted(result TransitionResult) {
+	for _, t := range m {
+		t.TransitionCommitted(result)
+	}
+}
+
+func (m multiTelemetry) TransitionRejected(result TransitionResult) {
+	for _, t := range m {
+		t.TransitionRejected(result)
+	}
+}
+
+func (m multiTelemetry) TransitionFailed(result TransitionResult) {
+	for _, t := range m {
+		t.TransitionFailed(result)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordingTelemetry records the phases of the fires
+type recordingTelemetry struct {
+	phases []string
+}
+
+func (r *recordingTelemetry) TransitionStarted(result TransitionResult) {
+	r.phases = append(r.phases, fmt.Sprintf("started %s from %s", result.Event, result.From))
+}
+
+func (r *recordingTelemetry) TransitionCommitted(result TransitionResult) {
+	r.phases = append(r.phases, fmt.Sprintf("committed %s to %s", result.Event, result.To))
+}
+
+func (r *recordingTelemetry) TransitionRejected(result TransitionResult) {
+	r.phases = append(r.phases, fmt.Sprintf("rejected %s: %s", result.Event, result.Err))
+}
+
+func (r *recordingTelemetry) TransitionFailed(result TransitionResult) {
+	r.phases = append(r.phases, fmt.Sprintf("failed %s: %s", result.Event, result.Err))
+}
+
+func TestTelemetry(t *testing.T) {
+	first := &recordingTelemetry{}
+	second := &recordingTelemetry{}
+
+	events := transferEvents(&Transfer{})
+	events["capture"].Transitions[0].On = func(args ...any) error {
+		return fmt.Errorf("gateway timeout")
+	}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		Telemetry:    MultiTelemetry(first, NoopTelemetry{}, second),
+	})
+	sm.SetEvents(events)
+
+	require.NoError(t, sm.Fire("authorize", 100))
+	require.Error(t, sm.Fire("void", 150))
+	require.Error(t, sm.Fire("capture"))
+
+	require.Equal(t, []string{
+		"started authorize from pending",
+		"committed authorize to authorized",
+		"started void from authorized",
+		"rejected void: event void: no transition for event",
+		"started capture from authorized",
+		"failed capture: error during transition from authorized to captured: gateway timeout",
+	}, first.phases)
+	require.Equal(t, first.phases, second.phases)
+}
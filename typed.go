@@ -0,0 +1,205 @@
+package main
+
+import "context"
+
+// TypedTransition is a Transition with callbacks getting the subject
+// of the machine and the args as typed values, so they don't need
+// type assertions
+type TypedTransition[S any, A any] struct {
+	From State
+	To   State
+
+	// Guard returns true if the transition is allowed. It's not
+	// allowed when the event is fired with args that are not an A.
+	Guard func(subject *S, args A) bool
+
+	// SoftGuard flags risky transitions without blocking them, see
+	// Transition.SoftGuard. It doesn't flag the event when it's fired
+	// with args that are not an A.
+	SoftGuard func(subject *S, args A) (warn bool, reason string)
+
+	// On is called when the transition is triggered. If it returns an
+	// error, the transition is not executed, unless the error is
+	// ErrNoChange. Projections run it against a copy of the subject.
+	On func(subject *S, args A) error
+
+	// After is called after the transition
+	After func(subject *S, args A) error
+
+	// Effects are executed after the transition, see
+	// Transition.Effects. Their Run gets the A as the only arg.
+	Effects []Effect
+
+	// Weight is the relative likelihood of the transition used by
+	// Simulate
+	Weight float64
+
+	// RateLimit limits how often the transition is taken per subject,
+	// see Transition.RateLimit
+	RateLimit *RateLimit
+}
+
+// TypedEvent is an Event of a TypedStateMachine
+type TypedEvent[S any, A any] struct {
+	Transitions []TypedTransition[S, A]
+
+	Auto       bool
+	Disabled   bool
+	Feature    string
+	Idempotent bool
+
+	// ArgsSchema declares the args of the event, see FireValidated. The
+	// events are fired with a single A, so it's the only field of the
+	// schema and its Type is the %T of A.
+	ArgsSchema ArgsSchema
+}
+
+// TypedStateMachine is a StateMachine driving a subject of type S with
+// events fired with args of type A, e.g. a struct with the amount of a
+// transfer. Events fired without args, like automatic events and
+// timeouts, get the zero A.
+//
+// The untyped methods of the embedded StateMachine remain available,
+// e.g. sm.StateMachine.Fire, but firing args that are not an A fails
+// with ErrArgType.
+type TypedStateMachine[S any, A any] struct {
+	*StateMachine
+
+	subject *S
+}
+
+// NewTypedStateMachine returns a machine driving the subject. The
+// subject replaces Options.Subject.
+func NewTypedStateMachine[S any, A any](subject *S, opts Options) *TypedStateMachine[S, A] {
+	opts.Subject = subject
+
+	return &TypedStateMachine[S, A]{
+		StateMachine: NewStateMachine(opts),
+		subject:      subject,
+	}
+}
+
+// Subject returns the subject driven by the machine
+func (sm *TypedStateMachine[S, A]) Subject() *S {
+	return sm.subject
+}
+
+// SetEvents sets the events of the machine
+func (sm *TypedStateMachine[S, A]) SetEvents(events map[string]TypedEvent[S, A]) {
+	untyped := make(map[string]Event, len(events))
+
+	for name, event := range events {
+		transitions := make([]Transition, len(event.Transitions))
+		for i, transition := range event.Transitions {
+			transitions[i] = sm.untyped(transition)
+		}
+
+		untyped[name] = Event{
+			Transitions: transitions,
+			Auto:        event.Auto,
+			Disabled:    event.Disabled,
+			Feature:     event.Feature,
+			Idempotent:  event.Idempotent,
+			ArgsSchema:  event.ArgsSchema,
+		}
+	}
+
+	sm.StateMachine.SetEvents(untyped)
+}
+
+// Fire fires the event with the args
+func (sm *TypedStateMachine[S, A]) Fire(name string, args A) error {
+	return sm.StateMachine.Fire(name, args)
+}
+
+// FireContext fires the event with the args and the context
+func (sm *TypedStateMachine[S, A]) FireContext(ctx context.Context, name string, args A) error {
+	return sm.StateMachine.FireContext(ctx, name, args)
+}
+
+// CanFire returns true if firing the event with the args would select
+// a transition, see StateMachine.CanFire
+func (sm *TypedStateMachine[S, A]) CanFire(name string, args A) bool {
+	return sm.StateMachine.CanFire(name, args)
+}
+
+// untyped converts the typed transition into the transition executed
+// by the StateMachine
+func (sm *TypedStateMachine[S, A]) untyped(transition TypedTransition[S, A]) Transition {
+	untyped := Transition{
+		From:      transition.From,
+		To:        transition.To,
+		Effects:   transition.Effects,
+		Weight:    transition.Weight,
+		RateLimit: transition.RateLimit,
+	}
+
+	if guard := transition.Guard; guard != nil {
+		// the guard context has the copy of the subject in projections
+		untyped.ContextGuard = func(gc GuardContext, args ...any) bool {
+			typed, err := typedArgs[A](args)
+			if err != nil {
+				return false
+			}
+
+			subject, ok := gc.Subject().(*S)
+			if !ok {
+				subject = sm.subject
+			}
+
+			return guard(subject, typed)
+		}
+	}
+
+	if softGuard := transition.SoftGuard; softGuard != nil {
+		untyped.SoftGuard = func(args ...any) (bool, string) {
+			typed, err := typedArgs[A](args)
+			if err != nil {
+				return false, ""
+			}
+
+			return softGuard(sm.subject, typed)
+		}
+	}
+
+	if on := transition.On; on != nil {
+		// the context has the copy of the subject in projections
+		untyped.OnContext = func(ctx context.Context, args ...any) error {
+			typed, err := typedArgs[A](args)
+			if err != nil {
+				return err
+			}
+
+			subject, ok := SubjectOf(ctx).(*S)
+			if !ok {
+				subject = sm.subject
+			}
+
+			return on(subject, typed)
+		}
+	}
+
+	if after := transition.After; after != nil {
+		untyped.After = func(args ...any) error {
+			typed, err := typedArgs[A](args)
+			if err != nil {
+				return err
+			}
+
+			return after(sm.subject, typed)
+		}
+	}
+
+	return untyped
+}
+
+// typedArgs returns the args fired to a TypedStateMachine, or the zero
+// A when there are none
+func typedArgs[A any](args []any) (A, error) {
+	if len(args) == 0 {
+		var zero A
+		return zero, nil
+	}
+
+	return Arg[A](args, 0)
+}
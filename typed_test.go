@@ -0,0 +1,160 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type transferAmount struct {
+	Amount int
+}
+
+func typedTransferEvents() map[string]TypedEvent[Transfer, transferAmount] {
+	return map[string]TypedEvent[Transfer, transferAmount]{
+		"authorize": {
+			Transitions: []TypedTransition[Transfer, transferAmount]{{
+				From: StatePending,
+				To:   StateAuthorized,
+				On: func(xfr *Transfer, args transferAmount) error {
+					xfr.AuthorizedAmount = args.Amount
+					return nil
+				},
+			}},
+		},
+		"void": {
+			Transitions: []TypedTransition[Transfer, transferAmount]{
+				{
+					From: StateAuthorized,
+					To:   StatePartiallyAuthorized,
+					Guard: func(xfr *Transfer, args transferAmount) bool {
+						return args.Amount > 0 && args.Amount < xfr.AuthorizedAmount
+					},
+					On: func(xfr *Transfer, args transferAmount) error {
+						xfr.VoidedAmount += args.Amount
+						xfr.AuthorizedAmount -= args.Amount
+						return nil
+					},
+				},
+				{
+					From: StateAuthorized,
+					To:   StateVoided,
+					Guard: func(xfr *Transfer, args transferAmount) bool {
+						return args.Amount == 0 || args.Amount == xfr.AuthorizedAmount
+					},
+					On: func(xfr *Transfer, args transferAmount) error {
+						xfr.VoidedAmount += xfr.AuthorizedAmount
+						xfr.AuthorizedAmount = 0
+						return nil
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestTypedStateMachine(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	sm := NewTypedStateMachine[Transfer, transferAmount](xfr, Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(typedTransferEvents())
+
+	require.NoError(t, sm.Fire("authorize", transferAmount{Amount: 100}))
+	require.Equal(t, 100, sm.Subject().AuthorizedAmount)
+
+	require.True(t, sm.CanFire("void", transferAmount{Amount: 40}))
+	require.NoError(t, sm.Fire("void", transferAmount{Amount: 40}))
+	require.Equal(t, StatePartiallyAuthorized, sm.State())
+	require.Equal(t, 60, xfr.AuthorizedAmount)
+	require.Equal(t, 40, xfr.VoidedAmount)
+
+	t.Run("zero args", func(t *testing.T) {
+		xfr := &Transfer{ID: "xfr", AuthorizedAmount: 100}
+
+		sm := NewTypedStateMachine[Transfer, transferAmount](xfr, Options{
+			CurrentState: StateAuthorized,
+		})
+		sm.SetEvents(typedTransferEvents())
+
+		require.NoError(t, sm.StateMachine.Fire("void"))
+		require.Equal(t, StateVoided, sm.State())
+		require.Equal(t, 100, xfr.VoidedAmount)
+	})
+
+	t.Run("untyped args", func(t *testing.T) {
+		xfr := &Transfer{ID: "xfr"}
+
+		sm := NewTypedStateMachine[Transfer, transferAmount](xfr, Options{
+			CurrentState: StatePending,
+		})
+		sm.SetEvents(typedTransferEvents())
+
+		err := sm.StateMachine.Fire("authorize", 100)
+		require.ErrorIs(t, err, ErrArgType)
+		require.Equal(t, StatePending, sm.State())
+	})
+
+	t.Run("projection", func(t *testing.T) {
+		xfr := &Transfer{ID: "xfr", AuthorizedAmount: 100}
+
+		sm := NewTypedStateMachine[Transfer, transferAmount](xfr, Options{
+			CurrentState: StateAuthorized,
+		})
+		sm.SetEvents(typedTransferEvents())
+
+		projected, to, err := sm.Project("void", transferAmount{Amount: 30})
+		require.NoError(t, err)
+		require.Equal(t, StatePartiallyAuthorized, to)
+		require.Equal(t, 70, projected.(*Transfer).AuthorizedAmount)
+		require.Equal(t, 100, xfr.AuthorizedAmount)
+	})
+}
+
+func TestTypedTransitionOptions(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	var warnings []Warning
+	var published []any
+
+	sm := NewTypedStateMachine[Transfer, transferAmount](xfr, Options{
+		CurrentState: StatePending,
+		SubjectID:    "xfr",
+		OnWarning: func(w Warning) {
+			warnings = append(warnings, w)
+		},
+	})
+	sm.SetEvents(map[string]TypedEvent[Transfer, transferAmount]{
+		"authorize": {
+			ArgsSchema: ArgsSchema{{Name: "amount", Type: "main.transferAmount", Required: true}},
+			Transitions: []TypedTransition[Transfer, transferAmount]{{
+				From: StatePending,
+				To:   StateAuthorized,
+				SoftGuard: func(xfr *Transfer, args transferAmount) (bool, string) {
+					return args.Amount > 1000, "large authorization"
+				},
+				Effects: []Effect{{
+					Name: "publish",
+					Run: func(key string, args ...any) error {
+						published = append(published, args...)
+						return nil
+					},
+				}},
+				Weight:    2,
+				RateLimit: &RateLimit{Rate: 1, Burst: 1},
+			}},
+		},
+	})
+
+	untyped := sm.StateMachine.events["authorize"]
+	require.Equal(t, ArgsSchema{{Name: "amount", Type: "main.transferAmount", Required: true}}, untyped.ArgsSchema)
+	require.Equal(t, 2.0, untyped.Transitions[0].Weight)
+	require.Equal(t, &RateLimit{Rate: 1, Burst: 1}, untyped.Transitions[0].RateLimit)
+
+	require.NoError(t, sm.FireValidated("authorize", map[string]any{"amount": transferAmount{Amount: 5000}}))
+	require.Equal(t, StateAuthorized, sm.State())
+	require.Equal(t, []any{transferAmount{Amount: 5000}}, published)
+	require.Len(t, warnings, 1)
+	require.Equal(t, "large authorization", warnings[0].Reason)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Partition declares the args that are expected to land on exactly one
+// of the guarded transitions of the event from the state
+type Partition struct {
+	Event   string
+	From    State
+	Samples [][]any
+}
+
+type ValidateOptions struct {
+	// Partitions are checked to be collectively exhaustive and mutually
+	// exclusive
+	Partitions []Partition
+}
+
+// ValidationError lists all problems found by Validate
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid state machine: %s", strings.Join(e.Problems, "; "))
+}
+
+// Validate checks the definition of the state machine. Unless
+// hierarchical states are enabled, states must not contain the state
+// separator. For every partition it evaluates the guards of the
+// transitions from the state with each sample and reports samples that
+// match no transition (gaps) or more than one transition (overlaps).
+func (sm *StateMachine) Validate(opts ValidateOptions) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	var problems []string
+
+	if !sm.hierarchical {
+		for _, state := range sm.states() {
+			if strings.Contains(string(state), sm.separator()) {
+				problems = append(problems, fmt.Sprintf("state %s contains separator %q but hierarchical states are disabled", state, sm.separator()))
+			}
+		}
+	}
+
+	for _, partition := range opts.Partitions {
+		event, ok := sm.events[partition.Event]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("event %s: %s", partition.Event, ErrEventNotFound))
+			continue
+		}
+
+		for _, args := range partition.Samples {
+			var matched []string
+
+			for _, transition := range event.Transitions {
+				if transition.From != partition.From {
+					continue
+				}
+
+				gc := sm.guardContext(context.Background(), partition.Event, partition.From)
+				if !sm.guardAllows(gc, transition, args) {
+					continue
+				}
+
+				matched = append(matched, string(transition.To))
+			}
+
+			switch {
+			case len(matched) == 0:
+				problems = append(problems, fmt.Sprintf("event %s from %s: gap: no transition for args %v", partition.Event, partition.From, args))
+			case len(matched) > 1:
+				problems = append(problems, fmt.Sprintf("event %s from %s: overlap: args %v match transitions to %s", partition.Event, partition.From, args, strings.Join(matched, ", ")))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatePartitions(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(transferEvents(xfr))
+
+	err := sm.Fire("authorize", 100)
+	require.NoError(t, err)
+
+	err = sm.Validate(ValidateOptions{
+		Partitions: []Partition{
+			{
+				Event:   "void",
+				From:    StateAuthorized,
+				Samples: [][]any{{}, {50}, {100}, {150}},
+			},
+		},
+	})
+
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	require.Equal(t, []string{
+		"event void from authorized: gap: no transition for args [150]",
+	}, validationErr.Problems)
+}
+
+func TestValidatePartitionsOverlap(t *testing.T) {
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(map[string]Event{
+		"review": {
+			Transitions: []Transition{
+				{From: StatePending, To: StateAuthorized},
+				{From: StatePending, To: StateVoided},
+			},
+		},
+	})
+
+	err := sm.Validate(ValidateOptions{
+		Partitions: []Partition{
+			{Event: "review", From: StatePending, Samples: [][]any{{}}},
+		},
+	})
+	require.EqualError(t, err, "invalid state machine: event review from pending: overlap: args [] match transitions to authorized, voided")
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+var ErrStaleVersion = fmt.Errorf("stale version")
+
+// FireVersioned fires the event only if the version is greater than
+// the last applied version, e.g. the sequence number of a webhook.
+// Duplicated and out-of-order versions return ErrStaleVersion. The
+// version is recorded only when the fire succeeds.
+func (sm *StateMachine) FireVersioned(version int64, name string, args ...any) error {
+	sm.lockFire()
+	defer sm.unlockFire()
+
+	if version <= sm.version {
+		err := fmt.Errorf("event %s: version %d, last applied %d: %w", name, version, sm.version, ErrStaleVersion)
+		sm.countFailure(name, err)
+		return sm.handleError(name, err)
+	}
+
+	if err := sm.fire(context.Background(), name, args...); err != nil {
+		return sm.handleError(name, err)
+	}
+
+	sm.version = version
+
+	return nil
+}
+
+// LastVersion returns the last version applied by FireVersioned
+func (sm *StateMachine) LastVersion() int64 {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	return sm.version
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFireVersioned(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+	})
+	sm.SetEvents(transferEvents(xfr))
+
+	require.NoError(t, sm.FireVersioned(1, "authorize", 100))
+	require.NoError(t, sm.FireVersioned(2, "void", 50))
+
+	// replayed webhook
+	err := sm.FireVersioned(1, "authorize", 100)
+	require.ErrorIs(t, err, ErrStaleVersion)
+
+	require.Equal(t, int64(2), sm.LastVersion())
+	require.Equal(t, StatePartiallyAuthorized, sm.State())
+	require.Equal(t, 50, xfr.AuthorizedAmount)
+
+	// failed fires don't record the version
+	err = sm.FireVersioned(3, "capture")
+	require.ErrorIs(t, err, ErrNoTransitionForEvent)
+	require.Equal(t, int64(2), sm.LastVersion())
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// Warning flags a risky transition that was permitted
+type Warning struct {
+	Event  string
+	From   State
+	To     State
+	Reason string
+}
+
+// softGuardWarnings evaluates the soft guard of the transition and
+// returns the reasons it flagged
+func (sm *StateMachine) softGuardWarnings(event string, transition Transition, args []any) []string {
+	if transition.SoftGuard == nil {
+		return nil
+	}
+
+	var warn bool
+	var reason string
+
+	sm.notify(event, "SoftGuard", func() {
+		warn, reason = transition.SoftGuard(args...)
+	})
+
+	if !warn {
+		return nil
+	}
+
+	return []string{reason}
+}
+
+// AmountBalancer is implemented by subjects holding amounts that must
+// stay consistent across transitions, e.g. a transfer whose authorized,
+// captured and voided amounts must add up to the original amount
+type AmountBalancer interface {
+	// AmountBalanced returns an error describing the imbalance, if any
+	AmountBalanced() error
+}
+
+// balanceWarnings checks the amounts of the subject after the
+// transition and returns the imbalance as a warning. Subjects not
+// implementing AmountBalancer are not checked.
+func (sm *StateMachine) balanceWarnings(event string, subject any) []string {
+	balancer, ok := subject.(AmountBalancer)
+	if !ok {
+		return nil
+	}
+
+	var err error
+
+	sm.notify(event, "AmountBalanced", func() {
+		err = balancer.AmountBalanced()
+	})
+
+	if err == nil {
+		return nil
+	}
+
+	return []string{"unbalanced amounts: " + err.Error()}
+}
+
+// confirmedKey is the context key of the state confirmed before After
+type confirmedKey struct{}
+
+// ConfirmedState returns the state re-read before calling After when
+// Options.ConfirmBeforeAfter is set. AfterContext gets it with the
+// context, e.g. to publish the state it asserts:
+//
+//	AfterContext: func(ctx context.Context, args ...any) error {
+//		state, _ := ConfirmedState(ctx)
+//		return publish(xfr, state)
+//	},
+func ConfirmedState(ctx context.Context) (State, bool) {
+	state, ok := ctx.Value(confirmedKey{}).(State)
+	return state, ok
+}
+
+// confirmState re-reads the persisted state, bypassing the cache, when
+// the state has to be confirmed before After. It returns the context
+// for After carrying the confirmed state, or the reason After is
+// skipped when the state is not the committed one anymore. The caller
+// must hold the lock.
+func (sm *StateMachine) confirmState(ctx context.Context, to State) (context.Context, string) {
+	if !sm.confirmBeforeAfter || sm.resolver == nil {
+		return ctx, ""
+	}
+
+	confirmed, err := sm.resolver.Current(ctx)
+	switch {
+	case err != nil:
+		return ctx, fmt.Sprintf("After skipped: confirming state: %s", err)
+	case confirmed != to:
+		return ctx, fmt.Sprintf("After skipped: state changed to %s after commit", confirmed)
+	default:
+		return context.WithValue(ctx, confirmedKey{}, confirmed), ""
+	}
+}
+
+// warn reports the warnings of the transition to the warning observer.
+// The caller must hold the lock.
+func (sm *StateMachine) warn(event string, from, to State, reasons []string) {
+	if sm.onWarning == nil {
+		return
+	}
+
+	for _, reason := range reasons {
+		warning := Warning{
+			Event:  event,
+			From:   from,
+			To:     to,
+			Reason: reason,
+		}
+
+		sm.unlocked(func() {
+			sm.notify(event, "OnWarning", func() {
+				sm.onWarning(warning)
+			})
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSoftGuard(t *testing.T) {
+	xfr := &Transfer{ID: "xfr"}
+
+	events := transferEvents(xfr)
+	events["capture"] = Event{
+		Transitions: []Transition{
+			{
+				From: StateAuthorized,
+				To:   StateCaptured,
+				SoftGuard: func(args ...any) (bool, string) {
+					return xfr.AuthorizedAmount > 1000, "large capture"
+				},
+			},
+		},
+	}
+
+	var warnings []Warning
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		OnWarning: func(w Warning) {
+			warnings = append(warnings, w)
+		},
+	})
+	sm.SetEvents(events)
+
+	require.NoError(t, sm.Fire("authorize", 5000))
+	require.NoError(t, sm.Fire("capture"))
+	require.Equal(t, StateCaptured, sm.State())
+
+	require.Equal(t, []Warning{
+		{Event: "capture", From: StateAuthorized, To: StateCaptured, Reason: "large capture"},
+	}, warnings)
+
+	history := sm.History()
+	require.Len(t, history, 2)
+	require.Empty(t, history[0].Warnings)
+	require.Equal(t, []string{"large capture"}, history[1].Warnings)
+}
+
+// balancedTransfer is a transfer whose amounts must add up to Amount
+type balancedTransfer struct {
+	Transfer
+	Amount int
+}
+
+func (t *balancedTransfer) AmountBalanced() error {
+	sum := t.AuthorizedAmount + t.CapturedAmount + t.VoidedAmount
+	if sum != t.Amount {
+		return fmt.Errorf("authorized %d, captured %d and voided %d don't add up to %d", t.AuthorizedAmount, t.CapturedAmount, t.VoidedAmount, t.Amount)
+	}
+
+	return nil
+}
+
+func TestAmountBalanceWarning(t *testing.T) {
+	xfr := &balancedTransfer{Amount: 100}
+
+	var warnings []Warning
+
+	sm := NewStateMachine(Options{
+		CurrentState: StatePending,
+		Subject:      xfr,
+		OnWarning: func(w Warning) {
+			warnings = append(warnings, w)
+		},
+	})
+	sm.SetEvents(map[string]Event{
+		"authorize": {
+			Transitions: []Transition{{
+				From: StatePending,
+				To:   StateAuthorized,
+				On: func(args ...any) error {
+					xfr.AuthorizedAmount = 100
+					return nil
+				},
+			}},
+		},
+		"void": {
+			Transitions: []Transition{{
+				From: StateAuthorized,
+				To:   StatePartiallyAuthorized,
+				On: func(args ...any) error {
+					// the authorized amount is not reduced
+					xfr.VoidedAmount += 50
+					return nil
+				},
+			}},
+		},
+	})
+
+	require.NoError(t, sm.Fire("authorize"))
+	require.Empty(t, warnings)
+
+	require.NoError(t, sm.Fire("void"))
+	require.Equal(t, []Warning{{
+		Event:  "void",
+		From:   StateAuthorized,
+		To:     StatePartiallyAuthorized,
+		Reason: "unbalanced amounts: authorized 100, captured 0 and voided 50 don't add up to 100",
+	}}, warnings)
+
+	history := sm.History()
+	require.Equal(t, []string{warnings[0].Reason}, history[1].Warnings)
+}
+
+func TestConfirmBeforeAfter(t *testing.T) {
+	t.Run("state changed", func(t *testing.T) {
+		repo := newFakeRepository(map[string]State{"xfr": StateAuthorized})
+		// another process voids the transfer right after the capture
+		// is committed
+		repo.afterCommit = func(states map[string]State) {
+			states["xfr"] = StateVoided
+		}
+		historyStore := NewMemoryHistoryStore()
+
+		var afterCalled bool
+		var warnings []Warning
+
+		sm := NewStateMachine(Options{
+			Repository:         repo,
+			HistoryStore:       historyStore,
+			SubjectID:          "xfr",
+			ConfirmBeforeAfter: true,
+			OnWarning: func(w Warning) {
+				warnings = append(warnings, w)
+			},
+		})
+		sm.SetEvents(map[string]Event{
+			"capture": {
+				Transitions: []Transition{{
+					From: StateAuthorized,
+					To:   StateCaptured,
+					After: func(args ...any) error {
+						afterCalled = true
+						return nil
+					},
+				}},
+			},
+		})
+
+		require.NoError(t, sm.Fire("capture"))
+		require.False(t, afterCalled)
+
+		reason := "After skipped: state changed to voided after commit"
+		require.Equal(t, []Warning{{
+			Event:  "capture",
+			From:   StateAuthorized,
+			To:     StateCaptured,
+			Reason: reason,
+		}}, warnings)
+		require.Equal(t, []string{reason}, sm.History()[0].Warnings)
+
+		stored, err := historyStore.Load(context.Background(), "xfr")
+		require.NoError(t, err)
+		require.Len(t, stored, 1)
+		require.Equal(t, []string{reason}, stored[0].Warnings)
+	})
+
+	t.Run("state confirmed", func(t *testing.T) {
+		repo := newFakeRepository(map[string]State{"xfr": StateAuthorized})
+
+		var confirmed State
+		var warnings []Warning
+
+		sm := NewStateMachine(Options{
+			Repository:         repo,
+			SubjectID:          "xfr",
+			ConfirmBeforeAfter: true,
+			OnWarning: func(w Warning) {
+				warnings = append(warnings, w)
+			},
+		})
+		sm.SetEvents(map[string]Event{
+			"capture": {
+				Transitions: []Transition{{
+					From: StateAuthorized,
+					To:   StateCaptured,
+					AfterContext: func(ctx context.Context, args ...any) error {
+						state, ok := ConfirmedState(ctx)
+						require.True(t, ok)
+						confirmed = state
+						return nil
+					},
+				}},
+			},
+		})
+
+		require.NoError(t, sm.Fire("capture"))
+		require.Equal(t, StateCaptured, confirmed)
+		require.Empty(t, warnings)
+		require.Empty(t, sm.History()[0].Warnings)
+	})
+}